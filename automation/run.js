@@ -38,11 +38,12 @@ function listFromArg(arg) {
 
 function runOne(file) {
   console.log(`\n=== RUN ${file}`);
-  const res = spawnSync(process.execPath, [file], { encoding: 'utf8' });
-  process.stdout.write(res.stdout || '');
-  process.stderr.write(res.stderr || '');
+  const started = Date.now();
+  // Inherit stdio so test output streams through as it is produced
+  const res = spawnSync(process.execPath, [file], { stdio: 'inherit' });
   const ok = res.status === 0;
-  console.log(`--- ${ok ? 'PASS' : 'FAIL'} ${file}`);
+  const secs = ((Date.now() - started) / 1000).toFixed(2);
+  console.log(`--- ${ok ? 'PASS' : 'FAIL'} ${file} (${secs}s)`);
   return ok;
 }
 
@@ -19,6 +19,24 @@ function computeDateRange(now = new Date()) {
   return { start, end };
 }
 
+// Parse YYYY-MM-DD as a local calendar date (new Date("YYYY-MM-DD") is UTC)
+function parseYmd(str) {
+  const m = /^(\d{4})-(\d{2})-(\d{2})$/.exec(String(str || '').trim());
+  if (!m) return null;
+  return new Date(Number(m[1]), Number(m[2]) - 1, Number(m[3]));
+}
+
+// RANGE_START/RANGE_END are computed by the Go server (in its configured
+// timezone) and always win. The month-to-date fallback from QUERY_DATE only
+// applies when the script is run by hand.
+function rangeFromEnv(env = process.env) {
+  const start = parseYmd(env.RANGE_START);
+  const end = parseYmd(env.RANGE_END);
+  if (start && end) return { start, end };
+  const baseDate = parseYmd(env.QUERY_DATE) || new Date();
+  return computeDateRange(baseDate);
+}
+
 // Open directly via URL (legacy)
 async function openDirect(page, baseUrl) {
   const url = new URL(PATH, baseUrl).toString();
@@ -122,4 +140,4 @@ async function triggerExport(page) {
   return download;
 }
 
-module.exports = { PATH, computeDateRange, openDirect, openViaButton, openViaDashboardMenu, clickVentasButton, setDateRange, consultar, triggerExport };
+module.exports = { PATH, ymd, parseYmd, computeDateRange, rangeFromEnv, openDirect, openViaButton, openViaDashboardMenu, clickVentasButton, setDateRange, consultar, triggerExport };
@@ -7,7 +7,7 @@ const fsp = require('node:fs/promises');
 const path = require('node:path');
 const { chromium } = require('playwright');
 const { login } = require('../../core/login');
-const { computeDateRange, openViaDashboardMenu, setDateRange, consultar, triggerExport } = require('../../runtimes/bateo_ventas');
+const { rangeFromEnv, openViaDashboardMenu, setDateRange, consultar, triggerExport } = require('../../runtimes/bateo_ventas');
 
 (async () => {
   // Config via env with safe defaults (replace envs in CI)
@@ -29,10 +29,8 @@ const { computeDateRange, openViaDashboardMenu, setDateRange, consultar, trigger
     await openViaDashboardMenu(page);
     console.log('[STEP] Módulo Bateo abierto');
 
-    // Allow overriding the base date via env QUERY_DATE (YYYY-MM-DD)
-    const queryDateStr = process.env.QUERY_DATE;
-    const baseDate = queryDateStr ? new Date(queryDateStr) : new Date();
-    const { start, end } = computeDateRange(baseDate);
+    // Explicit RANGE_START/RANGE_END, or month-to-date from QUERY_DATE (YYYY-MM-DD)
+    const { start, end } = rangeFromEnv(process.env);
     const pad = (n) => String(n).padStart(2, '0');
     const fmt = (d) => `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())}`;
     console.log(`[STEP] Estableciendo rango: ${fmt(start)} a ${fmt(end)}`);
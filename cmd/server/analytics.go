@@ -0,0 +1,100 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "automation/api/internal/analytics"
+)
+
+// registerAnalyticsRoutes exposes ventas aggregates over the ingested data.
+// Every route takes from/to (YYYY-MM-DD) and an optional sucursal:
+//
+//   GET /analytics/ventas/by-branch           -> per sucursal
+//   GET /analytics/ventas/by-day              -> per fecha
+//   GET /analytics/ventas/by-product          -> per product
+//   GET /analytics/ventas/top-products?limit= -> best-selling products (default 20)
+//
+// and a month-over-month comparison:
+//
+//   GET /analytics/ventas/compare?current=YYYY-MM[&previous=YYYY-MM | &against=previous-month|last-year]
+func registerAnalyticsRoutes(mux *http.ServeMux) {
+    handle := func(path string, fn func(q analytics.Query, r *http.Request) (analytics.Report, error)) {
+        mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+            if r.Method != http.MethodGet {
+                methodNotAllowed(w)
+                return
+            }
+            v := r.URL.Query()
+            q := analytics.Query{
+                From:     strings.TrimSpace(v.Get("from")),
+                To:       strings.TrimSpace(v.Get("to")),
+                Sucursal: strings.TrimSpace(v.Get("sucursal")),
+            }
+            rep, err := fn(q, r)
+            if errors.Is(err, analytics.ErrInvalidQuery) {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+                return
+            }
+            if err != nil {
+                writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+                return
+            }
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": rep})
+        })
+    }
+
+    handle("/analytics/ventas/by-branch", func(q analytics.Query, _ *http.Request) (analytics.Report, error) {
+        return analytics.ByBranch(dbFile, q)
+    })
+    handle("/analytics/ventas/by-day", func(q analytics.Query, _ *http.Request) (analytics.Report, error) {
+        return analytics.ByDay(dbFile, q)
+    })
+    handle("/analytics/ventas/by-product", func(q analytics.Query, _ *http.Request) (analytics.Report, error) {
+        return analytics.ByProduct(dbFile, q, 0)
+    })
+    mux.HandleFunc("/analytics/ventas/compare", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            methodNotAllowed(w)
+            return
+        }
+        v := r.URL.Query()
+        current := strings.TrimSpace(v.Get("current"))
+        previous := strings.TrimSpace(v.Get("previous"))
+        var err error
+        if previous == "" {
+            switch v.Get("against") {
+            case "", "previous-month":
+                previous, err = analytics.PreviousMonth(current)
+            case "last-year":
+                previous, err = analytics.SameMonthLastYear(current)
+            default:
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "against must be previous-month or last-year"})
+                return
+            }
+        }
+        var cmp analytics.Comparison
+        if err == nil {
+            cmp, err = analytics.Compare(dbFile, current, previous)
+        }
+        if errors.Is(err, analytics.ErrInvalidQuery) {
+            writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        if err != nil {
+            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": cmp})
+    })
+
+    handle("/analytics/ventas/top-products", func(q analytics.Query, r *http.Request) (analytics.Report, error) {
+        limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+        if limit <= 0 || limit > 500 {
+            limit = 20
+        }
+        return analytics.ByProduct(dbFile, q, limit)
+    })
+}
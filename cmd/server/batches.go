@@ -0,0 +1,157 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "automation/api/internal/export"
+    "automation/api/internal/ingest"
+)
+
+// registerBatchRoutes exposes the ingested data:
+//
+//   GET /batches?from=&to=&filename=&createdFrom=&createdTo=&reportType=&current=true&limit=&offset=
+//                                -> batches newest first
+//   GET /batches/{id}            -> batch metadata and column list
+//   GET /batches/{id}/rows?cursor=&limit=&columns=a,b&<column>=<value>
+//                                -> rows in ID order, one page at a time
+//   GET /batches/{id}/export?format=csv|xlsx|ndjson|parquet
+//                                -> every row as a file with normalized columns
+func registerBatchRoutes(mux *http.ServeMux) {
+    mux.HandleFunc("/batches", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            methodNotAllowed(w)
+            return
+        }
+        q := r.URL.Query()
+        f := ingest.BatchFilter{
+            From:        q.Get("from"),
+            To:          q.Get("to"),
+            Filename:    q.Get("filename"),
+            CreatedFrom: q.Get("createdFrom"),
+            CreatedTo:   q.Get("createdTo"),
+            ReportType:  q.Get("reportType"),
+        }
+        f.Limit, _ = strconv.Atoi(q.Get("limit"))
+        f.Offset, _ = strconv.Atoi(q.Get("offset"))
+        if v := q.Get("current"); v != "" {
+            cur, err := strconv.ParseBool(v)
+            if err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "invalid current filter"})
+                return
+            }
+            f.Current = cur
+        }
+        list, err := ingest.ListBatches(dbFile, f)
+        if err != nil {
+            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": list})
+    })
+
+    mux.HandleFunc("/batches/", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            methodNotAllowed(w)
+            return
+        }
+        // Expected: /batches/<id>[/rows|/export]
+        parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/batches/"), "/")
+        id, err := strconv.ParseInt(parts[0], 10, 64)
+        if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "rows" && parts[1] != "export") {
+            http.NotFound(w, r)
+            return
+        }
+        if len(parts) == 2 && parts[1] == "export" {
+            exportBatch(w, r, id)
+            return
+        }
+        if len(parts) == 1 {
+            batch, err := ingest.GetBatch(dbFile, id)
+            if writeBatchError(w, err) {
+                return
+            }
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": batch})
+            return
+        }
+
+        q := r.URL.Query()
+        rq := ingest.RowQuery{Filters: map[string]string{}}
+        if v := q.Get("cursor"); v != "" {
+            if rq.After, err = strconv.ParseInt(v, 10, 64); err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "invalid cursor"})
+                return
+            }
+        }
+        rq.Limit, _ = strconv.Atoi(q.Get("limit"))
+        if v := strings.TrimSpace(q.Get("columns")); v != "" {
+            for _, c := range strings.Split(v, ",") {
+                if c = strings.TrimSpace(c); c != "" {
+                    rq.Columns = append(rq.Columns, c)
+                }
+            }
+        }
+        // any other parameter filters on a column of the batch: ?sucursal=F0113
+        for k, v := range q {
+            switch k {
+            case "cursor", "limit", "columns":
+                continue
+            }
+            rq.Filters[k] = v[0]
+        }
+        page, err := ingest.BatchRows(dbFile, id, rq)
+        if writeBatchError(w, err) {
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": page})
+    })
+}
+
+// exportBatch streams every row of a batch in the requested format.
+func exportBatch(w http.ResponseWriter, r *http.Request, id int64) {
+    format := strings.ToLower(r.URL.Query().Get("format"))
+    if format == "" {
+        format = "csv"
+    }
+    contentType, ok := export.Formats[format]
+    if !ok {
+        writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "format must be csv, xlsx, ndjson or parquet"})
+        return
+    }
+    batch, err := ingest.GetBatch(dbFile, id)
+    if writeBatchError(w, err) {
+        return
+    }
+    cols, err := ingest.ExportColumns(batch)
+    if writeBatchError(w, err) {
+        return
+    }
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=batch_%d.%s", id, format))
+    rows := func(fn func(ingest.Row) error) error {
+        return ingest.EachRow(dbFile, id, fn)
+    }
+    if err := export.Write(w, format, cols, rows); err != nil {
+        // headers are gone by now; all we can do is cut the body short
+        log.Printf("export batch %d as %s: %v", id, format, err)
+    }
+}
+
+// writeBatchError writes err, if any, and reports whether it did.
+func writeBatchError(w http.ResponseWriter, err error) bool {
+    switch {
+    case err == nil:
+        return false
+    case errors.Is(err, ingest.ErrBatchNotFound):
+        writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": err.Error()})
+    case errors.Is(err, ingest.ErrUnknownColumn):
+        writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+    default:
+        writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+    }
+    return true
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "automation/api/internal/bateo"
+    "automation/api/internal/ingest"
+)
+
+// maxUploadBytes bounds a POST /ingest body.
+var maxUploadBytes int64 = 50 << 20
+
+// registerIngestRoutes exposes ingest without running the browser flow:
+//
+//   POST /ingest (multipart: file, rangeStart, rangeEnd[, reportType, locale])
+//     -> stores the file under automation/downloads and ingests it
+func registerIngestRoutes(mux *http.ServeMux) {
+    mux.HandleFunc("/ingest", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            methodNotAllowed(w)
+            return
+        }
+        r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+        if err := r.ParseMultipartForm(8 << 20); err != nil {
+            var tooBig *http.MaxBytesError
+            if errors.As(err, &tooBig) {
+                writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"ok": false, "error": fmt.Sprintf("upload exceeds %d bytes", maxUploadBytes)})
+                return
+            }
+            writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "expected multipart/form-data: " + err.Error()})
+            return
+        }
+        defer r.MultipartForm.RemoveAll()
+
+        rangeStart := strings.TrimSpace(r.FormValue("rangeStart"))
+        rangeEnd := strings.TrimSpace(r.FormValue("rangeEnd"))
+        if err := bateo.ValidateRange(rangeStart, rangeEnd, time.Now()); err != nil {
+            writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        file, hdr, err := r.FormFile("file")
+        if err != nil {
+            writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "missing file"})
+            return
+        }
+        defer file.Close()
+        ext := strings.ToLower(filepath.Ext(hdr.Filename))
+        if ext != ".xls" && ext != ".xlsx" && ext != ".csv" {
+            writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "file must be .xls, .xlsx or .csv"})
+            return
+        }
+
+        path, err := saveUpload(file, hdr.Filename, rangeStart, rangeEnd)
+        if err != nil {
+            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        batch, err := ingest.Ingest(dbFile, path, ingest.Options{
+            RangeStart: rangeStart,
+            RangeEnd:   rangeEnd,
+            ReportType: strings.TrimSpace(r.FormValue("reportType")),
+            Locale:     strings.TrimSpace(r.FormValue("locale")),
+        })
+        if err != nil {
+            _ = os.Remove(path)
+            code := http.StatusUnprocessableEntity
+            if errors.Is(err, ingest.ErrUnknownReportType) {
+                code = http.StatusBadRequest
+            }
+            writeJSON(w, code, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        if batch.Duplicate {
+            // the file already on record is the one the batch points to
+            if batch.Filename != filepath.Base(path) {
+                _ = os.Remove(path)
+            }
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": batch})
+            return
+        }
+        w.Header().Set("Location", fmt.Sprintf("/batches/%d", batch.ID))
+        writeJSON(w, http.StatusCreated, map[string]any{"ok": true, "data": batch})
+    })
+}
+
+// saveUpload writes an uploaded file to automation/downloads as
+// <name>_<start>_a_<end><ext>, the same naming the export flow uses, adding
+// _2, _3, ... instead of overwriting an existing file.
+func saveUpload(src io.Reader, filename, rangeStart, rangeEnd string) (string, error) {
+    dir := filepath.Join("automation", "downloads")
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return "", err
+    }
+    ext := strings.ToLower(filepath.Ext(filename))
+    base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+    base = strings.Map(func(r rune) rune {
+        if r == '/' || r == '\\' || r < ' ' {
+            return '_'
+        }
+        return r
+    }, base)
+    if base == "" || base == "." || base == ".." {
+        base = "upload"
+    }
+    base = strings.TrimSuffix(base, "_"+rangeStart+"_a_"+rangeEnd)
+    name := base + "_" + rangeStart + "_a_" + rangeEnd
+
+    for n := 1; ; n++ {
+        path := filepath.Join(dir, name+ext)
+        if n > 1 {
+            path = filepath.Join(dir, fmt.Sprintf("%s_%d%s", name, n, ext))
+        }
+        f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+        if errors.Is(err, os.ErrExist) {
+            continue
+        }
+        if err != nil {
+            return "", err
+        }
+        if _, err := io.Copy(f, src); err != nil {
+            f.Close()
+            _ = os.Remove(path)
+            return "", err
+        }
+        return path, f.Close()
+    }
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "automation/api/internal/bateo"
+    "automation/api/internal/jobs"
+    "automation/api/internal/runner"
+)
+
+// jobRequest is the body accepted by POST /jobs.
+type jobRequest struct {
+    Kind    string `json:"kind"` // all | group | test | bateo-export | bateo-backfill
+    Group   string `json:"group,omitempty"`
+    Test    string `json:"test,omitempty"`
+    Date    string `json:"date,omitempty"`
+    Start   string `json:"start,omitempty"` // bateo-export: explicit range, YYYY-MM-DD
+    End     string `json:"end,omitempty"`
+    Refresh bool   `json:"refresh,omitempty"`
+    From    string `json:"from,omitempty"`  // bateo-backfill: first month, YYYY-MM
+    To      string `json:"to,omitempty"`    // bateo-backfill: last month, YYYY-MM
+    Force   bool   `json:"force,omitempty"` // bateo-backfill: re-export months already ingested
+    BaseURL string `json:"baseUrl,omitempty"`
+    User    string `json:"user,omitempty"`
+    Pass    string `json:"pass,omitempty"`
+}
+
+// jobFunc validates the request and builds the function the job will run.
+func (req jobRequest) jobFunc(exporter *bateo.Exporter) (jobs.Func, error) {
+    switch req.Kind {
+    case "all":
+        return func(ctx context.Context, h jobs.Hooks) (runner.ExecResult, any) {
+            return runner.Run(ctx, "automation", h.Attach(runner.AllCommand())), nil
+        }, nil
+    case "group", "test":
+        group := filepath.Clean(req.Group)
+        if req.Group == "" || strings.Contains(group, "..") {
+            return nil, errors.New("invalid group")
+        }
+        if req.Kind == "group" {
+            return func(ctx context.Context, h jobs.Hooks) (runner.ExecResult, any) {
+                return runner.Run(ctx, "automation", h.Attach(runner.GroupCommand(group))), nil
+            }, nil
+        }
+        test := filepath.Clean(req.Test)
+        if req.Test == "" || strings.Contains(test, "..") {
+            return nil, errors.New("invalid test")
+        }
+        test = resolveTestName(group, test)
+        return func(ctx context.Context, h jobs.Hooks) (runner.ExecResult, any) {
+            return runner.Run(ctx, "automation", h.Attach(runner.TestCommand(group, test))), nil
+        }, nil
+    case "bateo-export":
+        baseURL, user, pass := erpCredentials(req.BaseURL, req.User, req.Pass)
+        breq := bateo.Request{BaseURL: baseURL, User: user, Pass: pass, Date: req.Date, Start: req.Start, End: req.End, Refresh: req.Refresh}
+        if _, _, err := breq.Range(time.Now()); err != nil {
+            return nil, err
+        }
+        return func(ctx context.Context, h jobs.Hooks) (runner.ExecResult, any) {
+            exp, err := exporter.Export(ctx, breq, h.Attach)
+            res := exp.Result
+            if err != nil {
+                res.OK = false
+                res.Error = err.Error()
+                return res, nil
+            }
+            if !res.OK {
+                return res, nil
+            }
+            return res, exp
+        }, nil
+    case "bateo-backfill":
+        if _, err := bateo.BackfillMonths(req.From, req.To, time.Now()); err != nil {
+            return nil, err
+        }
+        baseURL, user, pass := erpCredentials(req.BaseURL, req.User, req.Pass)
+        cred := bateo.Request{BaseURL: baseURL, User: user, Pass: pass}
+        from, to, force := req.From, req.To, req.Force
+        return func(ctx context.Context, h jobs.Hooks) (runner.ExecResult, any) {
+            start := time.Now()
+            list, err := exporter.Backfill(ctx, cred, from, to, force, h.Attach, func(p []bateo.MonthProgress) { h.Report(p) })
+            res := runner.ExecResult{
+                OK:         err == nil,
+                Command:    "backfill",
+                Args:       []string{from, to},
+                DurationMs: time.Since(start).Milliseconds(),
+                StartedAt:  start.UTC(),
+            }
+            if err != nil {
+                res.Error = err.Error()
+                return res, list
+            }
+            failed := 0
+            for _, m := range list {
+                if m.Status == "failed" || m.Status == "canceled" {
+                    failed++
+                }
+            }
+            if failed > 0 {
+                res.OK = false
+                res.Error = fmt.Sprintf("%d of %d months did not complete", failed, len(list))
+            }
+            return res, list
+        }, nil
+    default:
+        return nil, errors.New("unknown job kind (expected all, group, test, bateo-export or bateo-backfill)")
+    }
+}
+
+// submitJob validates req, starts it as a job and replies 202 with the job.
+func submitJob(w http.ResponseWriter, mgr *jobs.Manager, exporter *bateo.Exporter, req jobRequest) {
+    fn, err := req.jobFunc(exporter)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+        return
+    }
+    if runner.Full() {
+        w.Header().Set("Retry-After", strconv.Itoa(int(runner.RetryAfter().Seconds())))
+        writeJSON(w, http.StatusTooManyRequests, map[string]any{"ok": false, "error": runner.ErrQueueFull.Error(), "queue": runner.Stats()})
+        return
+    }
+    // never echo credentials back in job status
+    req.Pass = ""
+    job := mgr.Submit(req.Kind, req, fn)
+    w.Header().Set("Location", "/jobs/"+job.ID)
+    writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "data": job})
+}
+
+// registerJobRoutes exposes the asynchronous job API:
+//
+//   POST   /jobs            -> start a job, returns 202 with the job ID
+//   GET    /jobs            -> list known jobs
+//   GET    /jobs/{id}       -> job status and ExecResult once finished
+//   DELETE /jobs/{id}       -> cancel a queued or running job
+//   GET    /jobs/{id}/file  -> download the file produced by a bateo-export job
+//   GET    /jobs/{id}/logs  -> live stdout/stderr as Server-Sent Events
+func registerJobRoutes(mux *http.ServeMux, mgr *jobs.Manager, exporter *bateo.Exporter) {
+    mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case http.MethodGet:
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": mgr.List()})
+        case http.MethodPost:
+            var req jobRequest
+            if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "invalid JSON body"})
+                return
+            }
+            submitJob(w, mgr, exporter, req)
+        default:
+            methodNotAllowed(w)
+        }
+    })
+
+    mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+        // Expected: /jobs/<id>[/file]
+        parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+        id := parts[0]
+        if id == "" || len(parts) > 2 {
+            http.NotFound(w, r)
+            return
+        }
+
+        if len(parts) == 2 {
+            if r.Method != http.MethodGet {
+                methodNotAllowed(w)
+                return
+            }
+            switch parts[1] {
+            case "logs":
+                streamJobLogs(w, r, mgr, id)
+                return
+            case "file":
+            default:
+                http.NotFound(w, r)
+                return
+            }
+            job, ok := mgr.Get(id)
+            if !ok {
+                writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": jobs.ErrNotFound.Error()})
+                return
+            }
+            exp, ok := job.Output.(bateo.Export)
+            if !ok || exp.File == "" {
+                writeJSON(w, http.StatusConflict, map[string]any{"ok": false, "error": "job has no downloadable file", "status": job.Status})
+                return
+            }
+            serveDownload(w, exp.File)
+            return
+        }
+
+        switch r.Method {
+        case http.MethodGet:
+            job, ok := mgr.Get(id)
+            if !ok {
+                writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": jobs.ErrNotFound.Error()})
+                return
+            }
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": job})
+        case http.MethodDelete:
+            job, err := mgr.Cancel(id)
+            switch {
+            case errors.Is(err, jobs.ErrNotFound):
+                writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": err.Error()})
+            case errors.Is(err, jobs.ErrFinished):
+                writeJSON(w, http.StatusConflict, map[string]any{"ok": false, "error": err.Error(), "data": job})
+            default:
+                writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": job})
+            }
+        default:
+            methodNotAllowed(w)
+        }
+    })
+}
+
+// streamJobLogs sends job output as Server-Sent Events. Each line is an
+// event whose type is the line marker (step, info, download, pass, fail, ...)
+// and whose id is the line sequence, so clients can resume with
+// Last-Event-ID. A final "end" event carries the job status.
+func streamJobLogs(w http.ResponseWriter, r *http.Request, mgr *jobs.Manager, id string) {
+    logs, ok := mgr.Logs(id)
+    if !ok {
+        writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": jobs.ErrNotFound.Error()})
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": "streaming unsupported"})
+        return
+    }
+
+    seq, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    // disable proxy buffering (nginx) so lines arrive as they are produced
+    w.Header().Set("X-Accel-Buffering", "no")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    keepAlive := time.NewTicker(15 * time.Second)
+    defer keepAlive.Stop()
+    for {
+        lines, wait, closed := logs.Since(seq)
+        for _, ln := range lines {
+            b, _ := json.Marshal(ln)
+            fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ln.Seq, ln.Type, b)
+            seq = ln.Seq
+        }
+        if closed {
+            job, _ := mgr.Get(id)
+            b, _ := json.Marshal(map[string]any{"status": job.Status})
+            fmt.Fprintf(w, "event: end\ndata: %s\n\n", b)
+            flusher.Flush()
+            return
+        }
+        flusher.Flush()
+
+        select {
+        case <-r.Context().Done():
+            return
+        case <-wait:
+        case <-keepAlive.C:
+            fmt.Fprint(w, ": keep-alive\n\n")
+            flusher.Flush()
+        }
+    }
+}
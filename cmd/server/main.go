@@ -1,6 +1,8 @@
 package main
 
 import (
+    "context"
+    "errors"
     "fmt"
     "encoding/json"
     "io"
@@ -8,20 +10,60 @@ import (
     "net/http"
     "os"
     "path/filepath"
+    "strconv"
     "strings"
     "time"
 
+    "automation/api/internal/bateo"
     "automation/api/internal/runner"
+    "automation/api/internal/jobs"
+    "automation/api/internal/history"
     "automation/api/internal/ingest"
+    "automation/api/internal/schedule"
 )
 
+// dbFile is the SQLite store shared by ingest and run history.
+var dbFile = filepath.Join("automation", "data", "erp.sqlite")
+
 func main() {
+    runner.SetRecorder(func(res runner.ExecResult) int64 {
+        id, err := history.Record(dbFile, res)
+        if err != nil {
+            log.Printf("run history error: %v", err)
+        }
+        return id
+    })
+
+    runner.SetPool(runner.NewPool(
+        envInt("MAX_CONCURRENT_RUNS", 2),
+        envInt("MAX_QUEUED_RUNS", 10),
+        time.Duration(envInt("MAX_QUEUE_WAIT_SECONDS", 0))*time.Second,
+    ))
+
+    if tz := strings.TrimSpace(os.Getenv("REPORT_TIMEZONE")); tz != "" {
+        if err := bateo.SetTimezone(tz); err != nil {
+            log.Fatalf("REPORT_TIMEZONE: %v", err)
+        }
+    }
+    exporter := bateo.NewExporter("automation", dbFile)
+    exporter.CacheTTL = time.Duration(envInt("EXPORT_CACHE_TTL_MINUTES", 60)) * time.Minute
+    bateo.MaxRangeDays = envInt("BATEO_MAX_RANGE_DAYS", bateo.MaxRangeDays)
+    exporter.ChunkDays = envInt("BATEO_CHUNK_DAYS", bateo.DefaultChunkDays)
+    ingest.MappingsDir = strings.TrimSpace(os.Getenv("INGEST_MAPPINGS_DIR"))
+    maxUploadBytes = int64(envInt("MAX_UPLOAD_MB", 50)) << 20
+    jobMgr := jobs.NewManager(time.Hour)
+
     mux := http.NewServeMux()
 
     mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
         writeJSON(w, http.StatusOK, map[string]any{"ok": true})
     })
 
+    // GET /queue -> runner slots and queue usage
+    mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": runner.Stats()})
+    })
+
     mux.HandleFunc("/tests", func(w http.ResponseWriter, r *http.Request) {
         idx, err := runner.ListTests("automation/tests")
         if err != nil {
@@ -31,8 +73,8 @@ func main() {
         writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": idx})
     })
 
-    // POST /bateo/ventas/fecha-rango -> performs login, sets date range (first of month to tomorrow),
-    // triggers export, ingests into SQLite and streams the Excel file
+    // POST /bateo/ventas/fecha-rango -> performs login, sets date range (first of month to yesterday,
+    // or the explicit start/end), triggers export, ingests into SQLite and streams the Excel file
     mux.HandleFunc("/bateo/ventas/fecha-rango", func(w http.ResponseWriter, r *http.Request) {
         if r.Method != http.MethodPost {
             methodNotAllowed(w)
@@ -42,70 +84,21 @@ func main() {
             BaseURL string `json:"baseUrl"`
             User    string `json:"user"`
             Pass    string `json:"pass"`
+            Start   string `json:"start"`
+            End     string `json:"end"`
         }
         _ = json.NewDecoder(r.Body).Decode(&body)
 
-        baseURL := firstNonEmpty(body.BaseURL, os.Getenv("ERP_BASE_URL"), "http://erpvm.kurigage.com")
-        user := firstNonEmpty(body.User, os.Getenv("ERP_USER"), "ricardo.valencia@farmaciasbustillos.com")
-        pass := firstNonEmpty(body.Pass, os.Getenv("ERP_PASS"), "P4u1A280325*")
-
-        // Run the full flow (default date = today)
-        res := runner.RunBateoExportForDate("automation", baseURL, user, pass, "")
-        if !res.OK {
-            writeJSON(w, http.StatusBadRequest, res)
-            return
-        }
-
-        // Determine downloaded file path from stdout
-        path := extractDownloadPath(res.Stdout)
-        if path == "" {
-            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": "failed to determine downloaded file path", "stdout": res.Stdout})
-            return
-        }
-
-        // Ingest into SQLite
-        // date is today by default here
-        today := time.Now().Format("2006-01-02")
-        rs, re := computeRange(today)
-        dbFile := filepath.Join("automation", "data", "erp.sqlite")
-        batch, err := ingest.IngestBateoExcel(dbFile, path, rs, re)
-        if err != nil {
-            log.Printf("ingest error: %v", err)
-            w.Header().Set("X-Ingest-OK", "false")
-            w.Header().Set("X-Ingest-Error", err.Error())
-        } else {
-            w.Header().Set("X-Ingest-OK", "true")
-            w.Header().Set("X-Ingest-DB", dbFile)
-            w.Header().Set("X-Ingest-Batch-Id", fmt.Sprintf("%d", batch.ID))
-            w.Header().Set("X-Ingest-Rows", fmt.Sprintf("%d", batch.Rows))
-            w.Header().Set("X-Ingest-Range-Start", batch.RangeStart)
-            w.Header().Set("X-Ingest-Range-End", batch.RangeEnd)
-        }
-
-        // Ensure path is under allowed downloads directory
-        abs, _ := filepath.Abs(path)
-        dlRoot, _ := filepath.Abs(filepath.Join("automation", "downloads"))
-        if !strings.HasPrefix(abs, dlRoot) {
-            writeJSON(w, http.StatusForbidden, map[string]any{"ok": false, "error": "download path outside allowed directory"})
-            return
-        }
+        baseURL, user, pass := erpCredentials(body.BaseURL, body.User, body.Pass)
 
-        f, err := os.Open(abs)
-        if err != nil {
-            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
-            return
-        }
-        defer f.Close()
-
-        ctype := contentTypeByExt(filepath.Ext(abs))
-        w.Header().Set("Content-Type", ctype)
-        w.Header().Set("Content-Disposition", "attachment; filename=\""+filepath.Base(abs)+"\"")
-        w.WriteHeader(http.StatusOK)
-        _, _ = io.Copy(w, f)
+        // Run the full flow (default date = today, or the explicit start/end)
+        exp, err := exporter.Export(context.Background(), bateo.Request{BaseURL: baseURL, User: user, Pass: pass, Start: body.Start, End: body.End}, nil)
+        writeExport(w, exp, err)
     })
 
-    // GET /bateo/ventas/export?date=YYYY-MM-DD
-    // Runs the flow for the given date (or today if omitted) and streams the downloaded Excel.
+    // GET /bateo/ventas/export?date=YYYY-MM-DD[&refresh=true] or ?start=YYYY-MM-DD&end=YYYY-MM-DD
+    // Runs the flow for the given date (or today if omitted) or explicit range and streams the downloaded Excel.
+    // A fresh export of the same range is served from disk unless refresh=true.
     mux.HandleFunc("/bateo/ventas/export", func(w http.ResponseWriter, r *http.Request) {
         if r.Method != http.MethodGet {
             methodNotAllowed(w)
@@ -113,64 +106,54 @@ func main() {
         }
         dateStr := strings.TrimSpace(r.URL.Query().Get("date"))
 
-        baseURL := firstNonEmpty(r.URL.Query().Get("baseUrl"), os.Getenv("ERP_BASE_URL"), "http://erpvm.kurigage.com")
-        user := firstNonEmpty(r.URL.Query().Get("user"), os.Getenv("ERP_USER"), "ricardo.valencia@farmaciasbustillos.com")
-        pass := firstNonEmpty(r.URL.Query().Get("pass"), os.Getenv("ERP_PASS"), "P4u1A280325*")
-
-        // If date is omitted, the Node test defaults to today; we still pass through value (possibly empty)
-        res := runner.RunBateoExportForDate("automation", baseURL, user, pass, dateStr)
-        if !res.OK {
-            writeJSON(w, http.StatusBadRequest, res)
-            return
-        }
+        q := r.URL.Query()
+        baseURL, user, pass := erpCredentials(q.Get("baseUrl"), q.Get("user"), q.Get("pass"))
+
+        // If date is omitted, the Node test defaults to today. Identical
+        // concurrent requests share one run and one ingest.
+        refresh, _ := strconv.ParseBool(q.Get("refresh"))
+        exp, err := exporter.Export(context.Background(), bateo.Request{
+            BaseURL: baseURL,
+            User:    user,
+            Pass:    pass,
+            Date:    dateStr,
+            Start:   q.Get("start"),
+            End:     q.Get("end"),
+            Refresh: refresh,
+        }, nil)
+        writeExport(w, exp, err)
+    })
 
-        // Extract download path from stdout
-        path := extractDownloadPath(res.Stdout)
-        if path == "" {
-            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": "failed to determine downloaded file path", "stdout": res.Stdout})
+    // POST /bateo/ventas/backfill {"from":"YYYY-MM","to":"YYYY-MM"[,"force":true]}
+    // Starts a job exporting and ingesting each month (using its last day);
+    // months already ingested are skipped. Progress per month is reported in
+    // GET /jobs/{id} under output.
+    mux.HandleFunc("/bateo/ventas/backfill", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            methodNotAllowed(w)
             return
         }
-
-        // Ingest into SQLite before streaming
-        // Compute rangeStart = first day of month, rangeEnd = date+1
-        rs, re := computeRange(dateStr)
-        dbFile := filepath.Join("automation", "data", "erp.sqlite")
-        batch, err := ingest.IngestBateoExcel(dbFile, path, rs, re)
-        if err != nil {
-            log.Printf("ingest error: %v", err)
-            // continue to stream file; annotate headers
-            w.Header().Set("X-Ingest-OK", "false")
-            w.Header().Set("X-Ingest-Error", err.Error())
-        } else {
-            w.Header().Set("X-Ingest-OK", "true")
-            w.Header().Set("X-Ingest-DB", dbFile)
-            w.Header().Set("X-Ingest-Batch-Id", fmt.Sprintf("%d", batch.ID))
-            w.Header().Set("X-Ingest-Rows", fmt.Sprintf("%d", batch.Rows))
-            w.Header().Set("X-Ingest-Range-Start", batch.RangeStart)
-            w.Header().Set("X-Ingest-Range-End", batch.RangeEnd)
-        }
-
-        // Basic containment: ensure file lives under automation/downloads
-        abs, _ := filepath.Abs(path)
-        dlRoot, _ := filepath.Abs(filepath.Join("automation", "downloads"))
-        if !strings.HasPrefix(abs, dlRoot) {
-            writeJSON(w, http.StatusForbidden, map[string]any{"ok": false, "error": "download path outside allowed directory"})
-            return
+        var body struct {
+            From    string `json:"from"`
+            To      string `json:"to"`
+            Force   bool   `json:"force"`
+            BaseURL string `json:"baseUrl"`
+            User    string `json:"user"`
+            Pass    string `json:"pass"`
         }
-
-        f, err := os.Open(abs)
-        if err != nil {
-            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+        if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+            writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "invalid JSON body"})
             return
         }
-        defer f.Close()
-
-        // Content-Type by extension
-        ctype := contentTypeByExt(filepath.Ext(abs))
-        w.Header().Set("Content-Type", ctype)
-        w.Header().Set("Content-Disposition", "attachment; filename=\""+filepath.Base(abs)+"\"")
-        w.WriteHeader(http.StatusOK)
-        _, _ = io.Copy(w, f)
+        submitJob(w, jobMgr, exporter, jobRequest{
+            Kind:    "bateo-backfill",
+            From:    strings.TrimSpace(body.From),
+            To:      strings.TrimSpace(body.To),
+            Force:   body.Force,
+            BaseURL: body.BaseURL,
+            User:    body.User,
+            Pass:    body.Pass,
+        })
     })
 
     // POST /run/all
@@ -180,11 +163,7 @@ func main() {
             return
         }
         res := runner.RunAll("automation")
-        status := http.StatusOK
-        if !res.OK {
-            status = http.StatusBadRequest
-        }
-        writeJSON(w, status, res)
+        writeRunResult(w, res)
     })
 
     // Dynamic: /run/{group} or /run/{group}/{test}
@@ -209,11 +188,7 @@ func main() {
         // optional test
         if len(parts) == 1 {
             res := runner.RunGroup("automation", group)
-            status := http.StatusOK
-            if !res.OK {
-                status = http.StatusBadRequest
-            }
-            writeJSON(w, status, res)
+            writeRunResult(w, res)
             return
         }
 
@@ -223,22 +198,21 @@ func main() {
             return
         }
 
-        // Accept test with or without extension; default to .js
-        if !hasKnownTestExt(test) {
-            if _, err := os.Stat(filepath.Join("automation", "tests", group, test+".js")); err == nil {
-                test = test + ".js"
-            } else if _, err := os.Stat(filepath.Join("automation", "tests", group, test+".mjs")); err == nil {
-                test = test + ".mjs"
-            }
-        }
+        res := runner.RunTest("automation", group, resolveTestName(group, test))
+        writeRunResult(w, res)
+    })
 
-        res := runner.RunTest("automation", group, test)
-        status := http.StatusOK
-        if !res.OK {
-            status = http.StatusBadRequest
-        }
-        writeJSON(w, status, res)
+    registerJobRoutes(mux, jobMgr, exporter)
+    registerRunRoutes(mux)
+    registerIngestRoutes(mux)
+    registerBatchRoutes(mux)
+    registerAnalyticsRoutes(mux)
+
+    sched := schedule.NewScheduler(dbFile, func(ctx context.Context, s schedule.Schedule) schedule.Outcome {
+        return fireSchedule(ctx, s, jobMgr, exporter)
     })
+    sched.Start(context.Background())
+    registerScheduleRoutes(mux, sched, exporter)
 
     addr := ":8080"
     log.Printf("Starting API server on %s", addr)
@@ -253,6 +227,36 @@ func writeJSON(w http.ResponseWriter, code int, v any) {
     _ = json.NewEncoder(w).Encode(v)
 }
 
+// writeRunResult replies 200 for a passing run, 400 for a failing one and
+// 429/503 when the run could not get a slot.
+func writeRunResult(w http.ResponseWriter, res runner.ExecResult) {
+    if writeBusy(w, res) {
+        return
+    }
+    status := http.StatusOK
+    if !res.OK {
+        status = http.StatusBadRequest
+    }
+    writeJSON(w, status, res)
+}
+
+// writeBusy replies 429 (queue full) or 503 (queue wait exceeded) with a
+// Retry-After header when res never started for lack of a runner slot.
+func writeBusy(w http.ResponseWriter, res runner.ExecResult) bool {
+    var status int
+    switch {
+    case errors.Is(res.Err(), runner.ErrQueueFull):
+        status = http.StatusTooManyRequests
+    case errors.Is(res.Err(), runner.ErrQueueTimeout):
+        status = http.StatusServiceUnavailable
+    default:
+        return false
+    }
+    w.Header().Set("Retry-After", strconv.Itoa(int(runner.RetryAfter().Seconds())))
+    writeJSON(w, status, map[string]any{"ok": false, "error": res.Error, "queue": runner.Stats()})
+    return true
+}
+
 func methodNotAllowed(w http.ResponseWriter) {
     writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"ok": false, "error": "method not allowed"})
 }
@@ -260,7 +264,7 @@ func methodNotAllowed(w http.ResponseWriter) {
 func withCORS(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
+        w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
         w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
         if r.Method == http.MethodOptions {
             w.WriteHeader(http.StatusNoContent)
@@ -274,6 +278,25 @@ func hasKnownTestExt(name string) bool {
     return strings.HasSuffix(name, ".js") || strings.HasSuffix(name, ".mjs")
 }
 
+// resolveTestName accepts a test with or without extension; defaults to .js
+func resolveTestName(group, test string) string {
+    if !hasKnownTestExt(test) {
+        if _, err := os.Stat(filepath.Join("automation", "tests", group, test+".js")); err == nil {
+            return test + ".js"
+        } else if _, err := os.Stat(filepath.Join("automation", "tests", group, test+".mjs")); err == nil {
+            return test + ".mjs"
+        }
+    }
+    return test
+}
+
+func envInt(name string, def int) int {
+    if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name))); err == nil {
+        return v
+    }
+    return def
+}
+
 func firstNonEmpty(values ...string) string {
     for _, v := range values {
         if strings.TrimSpace(v) != "" {
@@ -283,22 +306,87 @@ func firstNonEmpty(values ...string) string {
     return ""
 }
 
-func extractDownloadPath(stdout string) string {
-    // Looks for a line like: [DOWNLOAD] saved to: /abs/path/file.xlsx (12345 bytes)
-    lines := strings.Split(stdout, "\n")
-    for _, ln := range lines {
-        ln = strings.TrimSpace(ln)
-        if strings.HasPrefix(ln, "[DOWNLOAD] saved to:") {
-            // Split after the prefix
-            rest := strings.TrimSpace(strings.TrimPrefix(ln, "[DOWNLOAD] saved to:"))
-            // Rest may contain path plus size in parentheses; strip trailing size
-            if idx := strings.LastIndex(rest, " ("); idx != -1 {
-                rest = strings.TrimSpace(rest[:idx])
-            }
-            return rest
-        }
+// erpCredentials fills empty values from ERP_* env vars and built-in defaults.
+func erpCredentials(baseURL, user, pass string) (string, string, string) {
+    return firstNonEmpty(baseURL, os.Getenv("ERP_BASE_URL"), "http://erpvm.kurigage.com"),
+        firstNonEmpty(user, os.Getenv("ERP_USER"), "ricardo.valencia@farmaciasbustillos.com"),
+        firstNonEmpty(pass, os.Getenv("ERP_PASS"), "P4u1A280325*")
+}
+
+// writeExport streams the exported file with ingest headers, or reports why
+// the export failed. On ingest failure the file is still streamed.
+func writeExport(w http.ResponseWriter, exp bateo.Export, err error) {
+    if errors.Is(err, bateo.ErrInvalidRange) {
+        writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+        return
+    }
+    res := exp.Result
+    if writeBusy(w, res) {
+        return
+    }
+    if !res.OK {
+        writeJSON(w, http.StatusBadRequest, res)
+        return
+    }
+    if err != nil {
+        writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error(), "stdout": res.Stdout})
+        return
+    }
+    writeIngestHeaders(w, exp)
+    serveDownload(w, exp.File)
+}
+
+func writeIngestHeaders(w http.ResponseWriter, exp bateo.Export) {
+    if exp.Shared {
+        w.Header().Set("X-Export-Shared", "true")
+    }
+    if exp.Cached {
+        w.Header().Set("X-Export-Cached", "true")
+    }
+    if len(exp.Chunks) > 0 {
+        w.Header().Set("X-Export-Chunks", fmt.Sprintf("%d", len(exp.Chunks)))
+    }
+    if exp.Batch == nil {
+        w.Header().Set("X-Ingest-OK", "false")
+        w.Header().Set("X-Ingest-Error", exp.IngestError)
+        return
+    }
+    w.Header().Set("X-Ingest-OK", "true")
+    w.Header().Set("X-Ingest-DB", exp.DB)
+    w.Header().Set("X-Ingest-Batch-Id", fmt.Sprintf("%d", exp.Batch.ID))
+    w.Header().Set("X-Ingest-Rows", fmt.Sprintf("%d", exp.Batch.Rows))
+    w.Header().Set("X-Ingest-Range-Start", exp.Batch.RangeStart)
+    w.Header().Set("X-Ingest-Range-End", exp.Batch.RangeEnd)
+    if exp.Batch.Duplicate {
+        w.Header().Set("X-Ingest-Duplicate", "true")
+    }
+    if exp.Batch.Supersedes != 0 {
+        w.Header().Set("X-Ingest-Supersedes", fmt.Sprintf("%d", exp.Batch.Supersedes))
     }
-    return ""
+}
+
+// serveDownload streams a file from automation/downloads as an attachment.
+func serveDownload(w http.ResponseWriter, path string) {
+    // Basic containment: ensure file lives under automation/downloads
+    abs, _ := filepath.Abs(path)
+    dlRoot, _ := filepath.Abs(filepath.Join("automation", "downloads"))
+    if !strings.HasPrefix(abs, dlRoot) {
+        writeJSON(w, http.StatusForbidden, map[string]any{"ok": false, "error": "download path outside allowed directory"})
+        return
+    }
+
+    f, err := os.Open(abs)
+    if err != nil {
+        writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+        return
+    }
+    defer f.Close()
+
+    ctype := contentTypeByExt(filepath.Ext(abs))
+    w.Header().Set("Content-Type", ctype)
+    w.Header().Set("Content-Disposition", "attachment; filename=\""+filepath.Base(abs)+"\"")
+    w.WriteHeader(http.StatusOK)
+    _, _ = io.Copy(w, f)
 }
 
 func contentTypeByExt(ext string) string {
@@ -313,20 +401,3 @@ func contentTypeByExt(ext string) string {
         return "application/octet-stream"
     }
 }
-
-// computeRange returns (start, end) for the given YYYY-MM-DD string where
-// start is the first day of the month and end is (date + 1 day), formatted as YYYY-MM-DD.
-func computeRange(dateStr string) (string, string) {
-    t, err := time.Parse("2006-01-02", dateStr)
-    if err != nil {
-        // fallback to today
-        t = time.Now()
-    }
-    start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
-    // Range end is the day before the consultation day
-    end := t.AddDate(0, 0, -1)
-    if end.Before(start) {
-        end = start
-    }
-    return start.Format("2006-01-02"), end.Format("2006-01-02")
-}
@@ -0,0 +1,93 @@
+package main
+
+import (
+    "errors"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "automation/api/internal/history"
+    "automation/api/internal/report"
+)
+
+// registerRunRoutes exposes the persisted run history:
+//
+//   GET /runs?limit=&offset=&ok=true|false -> newest runs first, without output
+//   GET /runs/{id}                          -> a single run with stdout/stderr
+//   GET /runs/{id}/report.xml               -> JUnit XML report
+//   GET /runs/{id}/report.tap               -> TAP version 13 report
+func registerRunRoutes(mux *http.ServeMux) {
+    mux.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            methodNotAllowed(w)
+            return
+        }
+        q := r.URL.Query()
+        var f history.Filter
+        f.Limit, _ = strconv.Atoi(q.Get("limit"))
+        f.Offset, _ = strconv.Atoi(q.Get("offset"))
+        if v := q.Get("ok"); v != "" {
+            ok, err := strconv.ParseBool(v)
+            if err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "invalid ok filter"})
+                return
+            }
+            f.OK = &ok
+        }
+        list, err := history.List(dbFile, f)
+        if err != nil {
+            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": list})
+    })
+
+    mux.HandleFunc("/runs/", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            methodNotAllowed(w)
+            return
+        }
+        // Expected: /runs/<id>[/report.xml|/report.tap]
+        parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+        id, err := strconv.ParseInt(parts[0], 10, 64)
+        if err != nil || len(parts) > 2 {
+            http.NotFound(w, r)
+            return
+        }
+        format := ""
+        if len(parts) == 2 {
+            format = parts[1]
+            if format != "report.xml" && format != "report.tap" {
+                http.NotFound(w, r)
+                return
+            }
+        }
+        run, err := history.Get(dbFile, id)
+        if errors.Is(err, history.ErrNotFound) {
+            writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        if err != nil {
+            writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+            return
+        }
+        switch format {
+        case "report.xml":
+            b, err := report.JUnit(run)
+            if err != nil {
+                writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+                return
+            }
+            w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+            w.WriteHeader(http.StatusOK)
+            _, _ = w.Write(b)
+        case "report.tap":
+            w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+            w.WriteHeader(http.StatusOK)
+            _, _ = io.WriteString(w, report.TAP(run))
+        default:
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": run})
+        }
+    })
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "automation/api/internal/bateo"
+    "automation/api/internal/jobs"
+    "automation/api/internal/schedule"
+)
+
+// scheduleBody is the body accepted by POST /schedules and PUT /schedules/{id}.
+type scheduleBody struct {
+    Name     string          `json:"name"`
+    Cron     string          `json:"cron"`
+    Every    string          `json:"every"`
+    Timezone string          `json:"timezone"`
+    Target   json.RawMessage `json:"target"`
+    Enabled  *bool           `json:"enabled"`
+}
+
+// toSchedule validates the target as a job request. Scheduled jobs always
+// use the server's ERP_* credentials, so credentials are not stored.
+func (b scheduleBody) toSchedule(exporter *bateo.Exporter) (schedule.Schedule, error) {
+    var req jobRequest
+    if err := json.Unmarshal(b.Target, &req); err != nil {
+        return schedule.Schedule{}, errors.New("target must be a job object like POST /jobs")
+    }
+    if _, err := req.jobFunc(exporter); err != nil {
+        return schedule.Schedule{}, err
+    }
+    req.BaseURL, req.User, req.Pass = "", "", ""
+    target, _ := json.Marshal(req)
+    s := schedule.Schedule{
+        Name:     b.Name,
+        Cron:     strings.TrimSpace(b.Cron),
+        Every:    strings.TrimSpace(b.Every),
+        Timezone: strings.TrimSpace(b.Timezone),
+        Target:   target,
+        Enabled:  b.Enabled == nil || *b.Enabled,
+    }
+    return s, nil
+}
+
+// fireSchedule submits the schedule's target as a job and waits for it, so
+// the firing shows up in /jobs (with live logs) and in /runs.
+func fireSchedule(ctx context.Context, s schedule.Schedule, mgr *jobs.Manager, exporter *bateo.Exporter) schedule.Outcome {
+    var req jobRequest
+    if err := json.Unmarshal(s.Target, &req); err != nil {
+        return schedule.Outcome{Error: err.Error()}
+    }
+    fn, err := req.jobFunc(exporter)
+    if err != nil {
+        return schedule.Outcome{Error: err.Error()}
+    }
+    job := mgr.Submit(req.Kind, map[string]any{"schedule": s.ID, "target": req}, fn)
+    done, err := mgr.Wait(ctx, job.ID)
+    if err != nil {
+        return schedule.Outcome{JobID: job.ID, Error: err.Error()}
+    }
+    out := schedule.Outcome{JobID: job.ID, OK: done.Status == jobs.StatusSucceeded, Error: done.Error}
+    if done.Result != nil {
+        out.RunID = done.Result.RunID
+    }
+    return out
+}
+
+// registerScheduleRoutes exposes schedule management:
+//
+//   GET    /schedules           -> list schedules
+//   POST   /schedules           -> create { name, cron | every, timezone, target, enabled }
+//   GET    /schedules/{id}      -> a single schedule
+//   PUT    /schedules/{id}      -> replace a schedule definition
+//   DELETE /schedules/{id}      -> delete a schedule and its history
+//   GET    /schedules/{id}/runs -> recent firings with job and run IDs
+func registerScheduleRoutes(mux *http.ServeMux, sched *schedule.Scheduler, exporter *bateo.Exporter) {
+    mux.HandleFunc("/schedules", func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case http.MethodGet:
+            list, err := schedule.List(dbFile)
+            if err != nil {
+                writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": err.Error()})
+                return
+            }
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": list})
+        case http.MethodPost:
+            var body scheduleBody
+            if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "invalid JSON body"})
+                return
+            }
+            s, err := body.toSchedule(exporter)
+            if err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+                return
+            }
+            s, err = schedule.Create(dbFile, s)
+            if err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+                return
+            }
+            sched.Wake()
+            writeJSON(w, http.StatusCreated, map[string]any{"ok": true, "data": s})
+        default:
+            methodNotAllowed(w)
+        }
+    })
+
+    mux.HandleFunc("/schedules/", func(w http.ResponseWriter, r *http.Request) {
+        // Expected: /schedules/<id>[/runs]
+        parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/schedules/"), "/")
+        id, err := strconv.ParseInt(parts[0], 10, 64)
+        if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "runs") {
+            http.NotFound(w, r)
+            return
+        }
+
+        if len(parts) == 2 {
+            if r.Method != http.MethodGet {
+                methodNotAllowed(w)
+                return
+            }
+            if _, err := schedule.Get(dbFile, id); err != nil {
+                writeScheduleError(w, err)
+                return
+            }
+            limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+            list, err := schedule.Firings(dbFile, id, limit)
+            if err != nil {
+                writeScheduleError(w, err)
+                return
+            }
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": list})
+            return
+        }
+
+        switch r.Method {
+        case http.MethodGet:
+            s, err := schedule.Get(dbFile, id)
+            if err != nil {
+                writeScheduleError(w, err)
+                return
+            }
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": s})
+        case http.MethodPut:
+            var body scheduleBody
+            if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "invalid JSON body"})
+                return
+            }
+            s, err := body.toSchedule(exporter)
+            if err != nil {
+                writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+                return
+            }
+            s.ID = id
+            s, err = schedule.Update(dbFile, s)
+            if err != nil {
+                writeScheduleError(w, err)
+                return
+            }
+            sched.Wake()
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true, "data": s})
+        case http.MethodDelete:
+            if err := schedule.Delete(dbFile, id); err != nil {
+                writeScheduleError(w, err)
+                return
+            }
+            sched.Wake()
+            writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+        default:
+            methodNotAllowed(w)
+        }
+    })
+}
+
+func writeScheduleError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, schedule.ErrNotFound):
+        writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": err.Error()})
+    default:
+        writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": err.Error()})
+    }
+}
@@ -0,0 +1,221 @@
+package analytics
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+
+    _ "modernc.org/sqlite"
+
+    "automation/api/internal/ingest"
+)
+
+// ErrInvalidQuery wraps every query validation failure.
+var ErrInvalidQuery = errors.New("invalid analytics query")
+
+// Query selects the ventas rows to aggregate: days From..To (YYYY-MM-DD,
+// inclusive), optionally of one branch.
+type Query struct {
+    From     string
+    To       string
+    Sucursal string
+}
+
+func (q Query) validate() error {
+    from, err := time.Parse("2006-01-02", q.From)
+    if err != nil {
+        return fmt.Errorf("%w: from %q is not YYYY-MM-DD", ErrInvalidQuery, q.From)
+    }
+    to, err := time.Parse("2006-01-02", q.To)
+    if err != nil {
+        return fmt.Errorf("%w: to %q is not YYYY-MM-DD", ErrInvalidQuery, q.To)
+    }
+    if to.Before(from) {
+        return fmt.Errorf("%w: from must not be after to", ErrInvalidQuery)
+    }
+    return nil
+}
+
+// Totals are the aggregates reported for every group. Importe and
+// Unidades sum the importe and cantidad columns; Tickets counts distinct
+// (sucursal, ticket) pairs, since each branch numbers its own tickets
+// (zero when the report has none); Rows counts the rows.
+// The Bateo report's metrics are summed too, and PorcentajeBateo is the
+// porcentaje_bateo of the rows weighted by their tickets_con_solicitados
+// (nil when no row has both).
+type Totals struct {
+    Importe                   float64  `json:"importe"`
+    Unidades                  float64  `json:"unidades"`
+    Tickets                   int      `json:"tickets"`
+    Rows                      int      `json:"rows"`
+    TicketsConSolicitados     float64  `json:"ticketsConSolicitados"`
+    CombinacionesConSugeridos float64  `json:"combinacionesConSugeridos"`
+    PorcentajeBateo           *float64 `json:"porcentajeBateo"`
+}
+
+// dest returns the scan destinations for totalsCols. The returned func
+// must be called after Scan to set the nullable fields.
+func (t *Totals) dest() ([]any, func()) {
+    var pb sql.NullFloat64
+    return []any{&t.Importe, &t.Unidades, &t.Tickets, &t.Rows, &t.TicketsConSolicitados, &t.CombinacionesConSugeridos, &pb}, func() {
+        t.PorcentajeBateo = nil
+        if pb.Valid {
+            v := pb.Float64
+            t.PorcentajeBateo = &v
+        }
+    }
+}
+
+// Group is one aggregated row: the key columns of the grouping plus Totals.
+type Group struct {
+    Sucursal string `json:"sucursal,omitempty"`
+    Fecha    string `json:"fecha,omitempty"`
+    SKU      string `json:"sku,omitempty"`
+    Producto string `json:"producto,omitempty"`
+    Totals
+}
+
+// Report is the result of an aggregation. ExcludedRows counts the rows
+// without a fecha that could not be placed in the period (see
+// effectiveRows) and are missing from Items and Total.
+type Report struct {
+    From         string  `json:"from"`
+    To           string  `json:"to"`
+    Items        []Group `json:"items"`
+    Total        Totals  `json:"total"`
+    ExcludedRows int     `json:"excludedRows"`
+}
+
+// effectiveRows selects, for each day of the query, the bateo_ventas rows
+// of the newest current batch whose range covers that day. A current batch
+// is a top-level batch no other batch supersedes; rows of chunks count for
+// their parent.
+//
+// Rows without a parsed fecha (the Bateo report summarizes its whole range)
+// are attributed to their batch's range: they count when ?4 is set, the
+// range lies within the query and no newer current batch overlaps it.
+// Otherwise they are left in excluded.
+const effectiveRows = `
+WITH cur AS (
+    SELECT b.id, b.range_start, b.range_end FROM ingest_batches b
+    WHERE b.parent_id IS NULL
+      AND NOT EXISTS (SELECT 1 FROM ingest_batches n WHERE n.supersedes_id = b.id)
+      AND b.range_end >= ?1 AND b.range_start <= ?2
+),
+v AS (
+    SELECT v.*, COALESCE(p.parent_id, p.id) AS top_id
+    FROM bateo_ventas v JOIN ingest_batches p ON p.id = v.batch_id
+    WHERE v.fecha BETWEEN ?1 AND ?2 AND (?3 = '' OR v.sucursal = ?3)
+),
+undated AS (
+    SELECT v.*, COALESCE(p.parent_id, p.id) AS top_id
+    FROM bateo_ventas v JOIN ingest_batches p ON p.id = v.batch_id
+    WHERE v.fecha IS NULL AND (?3 = '' OR v.sucursal = ?3)
+      AND COALESCE(p.parent_id, p.id) IN (SELECT id FROM cur)
+),
+placeable AS (
+    SELECT c.id FROM cur c
+    WHERE ?4 AND c.range_start >= ?1 AND c.range_end <= ?2
+      AND NOT EXISTS (SELECT 1 FROM cur n WHERE n.id > c.id
+                      AND n.range_start <= c.range_end AND n.range_end >= c.range_start)
+),
+excluded AS (
+    SELECT * FROM undated WHERE top_id NOT IN (SELECT id FROM placeable)
+),
+rows AS (
+    SELECT v.* FROM v
+    WHERE v.top_id = (SELECT c.id FROM cur c
+                      WHERE v.fecha BETWEEN c.range_start AND c.range_end
+                      ORDER BY c.id DESC LIMIT 1)
+    UNION ALL
+    SELECT * FROM undated WHERE top_id IN (SELECT id FROM placeable)
+)
+`
+
+const totalsCols = `COALESCE(SUM(importe), 0), COALESCE(SUM(cantidad), 0), COUNT(DISTINCT COALESCE(sucursal, '') || '|' || ticket), COUNT(*),
+    COALESCE(SUM(tickets_con_solicitados), 0), COALESCE(SUM(combinaciones_con_sugeridos), 0),
+    ROUND(SUM(porcentaje_bateo * tickets_con_solicitados)
+        / NULLIF(SUM(CASE WHEN porcentaje_bateo IS NOT NULL THEN tickets_con_solicitados END), 0), 2)`
+
+func openDB(dbPath string) (*sql.DB, error) {
+    if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+        return nil, err
+    }
+    if err := ingest.EnsureSchema(dbPath); err != nil {
+        return nil, err
+    }
+    return sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
+}
+
+// aggregate groups the effective rows by groupExpr. keyExprs are the
+// selected key columns, scanned into the Group fields returned by keys;
+// the totals follow them, so orderBy can refer to importe as column
+// len(keys)+1. undated includes the rows without a fecha that can be
+// attributed to the period.
+func aggregate(dbPath string, q Query, undated bool, keyExprs, groupExpr string, keys func(*Group) []any, orderBy string, limit int) (Report, error) {
+    rep := Report{From: q.From, To: q.To, Items: []Group{}}
+    if err := q.validate(); err != nil {
+        return rep, err
+    }
+    db, err := openDB(dbPath)
+    if err != nil {
+        return rep, err
+    }
+    defer db.Close()
+
+    args := []any{q.From, q.To, q.Sucursal, undated}
+    dest, done := rep.Total.dest()
+    dest = append(dest, &rep.ExcludedRows)
+    err = db.QueryRow(effectiveRows+`SELECT `+totalsCols+`, (SELECT COUNT(*) FROM excluded) FROM rows`, args...).Scan(dest...)
+    if err != nil {
+        return rep, err
+    }
+    done()
+
+    sqlq := effectiveRows + `SELECT ` + keyExprs + `, ` + totalsCols + ` FROM rows GROUP BY ` + groupExpr + ` ORDER BY ` + orderBy
+    if limit > 0 {
+        sqlq += fmt.Sprintf(` LIMIT %d`, limit)
+    }
+    rows, err := db.Query(sqlq, args...)
+    if err != nil {
+        return rep, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var g Group
+        totals, done := g.Totals.dest()
+        if err := rows.Scan(append(keys(&g), totals...)...); err != nil {
+            return rep, err
+        }
+        done()
+        rep.Items = append(rep.Items, g)
+    }
+    return rep, rows.Err()
+}
+
+// ByBranch aggregates per sucursal, largest importe (then tickets con
+// solicitados) first.
+func ByBranch(dbPath string, q Query) (Report, error) {
+    return aggregate(dbPath, q, true, `COALESCE(sucursal, '')`, `1`, func(g *Group) []any {
+        return []any{&g.Sucursal}
+    }, `2 DESC, 6 DESC, 1`, 0)
+}
+
+// ByDay aggregates per fecha, in date order. Rows without a fecha cannot
+// be placed on a day and are always excluded.
+func ByDay(dbPath string, q Query) (Report, error) {
+    return aggregate(dbPath, q, false, `fecha`, `1`, func(g *Group) []any {
+        return []any{&g.Fecha}
+    }, `1`, 0)
+}
+
+// ByProduct aggregates per product (its SKU, or its name when the report
+// has no SKU), largest importe first. limit <= 0 returns every product.
+func ByProduct(dbPath string, q Query, limit int) (Report, error) {
+    return aggregate(dbPath, q, true, `COALESCE(sku, ''), COALESCE(MAX(producto), '')`, `COALESCE(sku, producto)`, func(g *Group) []any {
+        return []any{&g.SKU, &g.Producto}
+    }, `3 DESC, 7 DESC, 2`, limit)
+}
@@ -0,0 +1,207 @@
+package analytics
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+
+    "automation/api/internal/ingest"
+)
+
+// testDB ingests each file (CSV text) for its range into a new database
+// and returns its path. Files are ingested in order, so a later file for
+// the same range supersedes an earlier one.
+func testDB(t *testing.T, files []testFile) string {
+    t.Helper()
+    dir := t.TempDir()
+    dbPath := filepath.Join(dir, "erp.sqlite")
+    for i, f := range files {
+        p := filepath.Join(dir, f.rangeStart+"_"+f.rangeEnd+"_"+string(rune('a'+i))+".csv")
+        if err := os.WriteFile(p, []byte(f.csv), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := ingest.IngestBateoExcel(dbPath, p, f.rangeStart, f.rangeEnd); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return dbPath
+}
+
+type testFile struct {
+    rangeStart, rangeEnd, csv string
+}
+
+// item is the part of a Group the tests compare.
+type item struct {
+    Key     string
+    Importe float64
+    Tickets int
+    Rows    int
+}
+
+func items(rep Report) []item {
+    out := []item{}
+    for _, g := range rep.Items {
+        out = append(out, item{Key: g.Sucursal + g.Fecha + g.SKU, Importe: g.Importe, Tickets: g.Tickets, Rows: g.Rows})
+    }
+    return out
+}
+
+var ventasFiles = []testFile{
+    // superseded by the next file for the same range
+    {"2024-01-01", "2024-01-31", "Sucursal,Fecha,Folio,SKU,Cantidad,Importe\nS1,10/01/2024,T9,A,100,1000.00\n"},
+    // folio T1 is used by both branches
+    {"2024-01-01", "2024-01-31", "Sucursal,Fecha,Folio,SKU,Producto,Cantidad,Importe\n" +
+        "S1,10/01/2024,T1,A,Aspirina,1,10.00\n" +
+        "S1,10/01/2024,T1,B,Bisolvon,2,20.00\n" +
+        "S2,10/01/2024,T1,A,Aspirina,1,10.00\n" +
+        "S2,11/01/2024,T2,A,Aspirina,3,30.00\n"},
+    // the Bateo report: one undated row per branch for the whole range
+    {"2024-02-01", "2024-02-29", "Sucursal,Tickets con solicitados,Combinaciones con sugeridos,% Bateo\n" +
+        "S1,100,20,20.00%\n" +
+        "S2,50,5,10.00%\n"},
+}
+
+func TestAggregate(t *testing.T) {
+    dbPath := testDB(t, ventasFiles)
+    jan := Query{From: "2024-01-01", To: "2024-01-31"}
+    feb := Query{From: "2024-02-01", To: "2024-02-29"}
+    tests := []struct {
+        name         string
+        run          func() (Report, error)
+        wantItems    []item
+        wantTickets  int
+        wantImporte  float64
+        wantExcluded int
+    }{
+        {
+            name: "by branch",
+            run:  func() (Report, error) { return ByBranch(dbPath, jan) },
+            wantItems: []item{
+                {Key: "S2", Importe: 40, Tickets: 2, Rows: 2},
+                {Key: "S1", Importe: 30, Tickets: 1, Rows: 2},
+            },
+            wantTickets: 3,
+            wantImporte: 70,
+        },
+        {
+            name: "one branch",
+            run:  func() (Report, error) { return ByBranch(dbPath, Query{From: jan.From, To: jan.To, Sucursal: "S1"}) },
+            wantItems: []item{
+                {Key: "S1", Importe: 30, Tickets: 1, Rows: 2},
+            },
+            wantTickets: 1,
+            wantImporte: 30,
+        },
+        {
+            name: "by day",
+            run:  func() (Report, error) { return ByDay(dbPath, jan) },
+            wantItems: []item{
+                {Key: "2024-01-10", Importe: 40, Tickets: 2, Rows: 3},
+                {Key: "2024-01-11", Importe: 30, Tickets: 1, Rows: 1},
+            },
+            wantTickets: 3,
+            wantImporte: 70,
+        },
+        {
+            name: "by product",
+            run:  func() (Report, error) { return ByProduct(dbPath, jan, 0) },
+            wantItems: []item{
+                {Key: "A", Importe: 50, Tickets: 3, Rows: 3},
+                {Key: "B", Importe: 20, Tickets: 1, Rows: 1},
+            },
+            wantTickets: 3,
+            wantImporte: 70,
+        },
+        {
+            name: "undated rows in their range",
+            run:  func() (Report, error) { return ByBranch(dbPath, feb) },
+            wantItems: []item{
+                {Key: "S1", Rows: 1},
+                {Key: "S2", Rows: 1},
+            },
+        },
+        {
+            name:         "undated rows outside a narrower query",
+            run:          func() (Report, error) { return ByBranch(dbPath, Query{From: "2024-02-01", To: "2024-02-15"}) },
+            wantItems:    []item{},
+            wantExcluded: 2,
+        },
+        {
+            name:         "undated rows by day",
+            run:          func() (Report, error) { return ByDay(dbPath, feb) },
+            wantItems:    []item{},
+            wantExcluded: 2,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rep, err := tt.run()
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got := items(rep); !reflect.DeepEqual(got, tt.wantItems) {
+                t.Errorf("items = %+v, want %+v", got, tt.wantItems)
+            }
+            if rep.Total.Tickets != tt.wantTickets || rep.Total.Importe != tt.wantImporte {
+                t.Errorf("total tickets, importe = %d, %v, want %d, %v", rep.Total.Tickets, rep.Total.Importe, tt.wantTickets, tt.wantImporte)
+            }
+            if rep.ExcludedRows != tt.wantExcluded {
+                t.Errorf("excludedRows = %d, want %d", rep.ExcludedRows, tt.wantExcluded)
+            }
+        })
+    }
+}
+
+// PorcentajeBateo is weighted by tickets con solicitados.
+func TestPorcentajeBateo(t *testing.T) {
+    dbPath := testDB(t, ventasFiles)
+    rep, err := ByBranch(dbPath, Query{From: "2024-02-01", To: "2024-02-29"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name        string
+        totals      Totals
+        solicitados float64
+        sugeridos   float64
+        porcentaje  float64
+    }{
+        {name: "total", totals: rep.Total, solicitados: 150, sugeridos: 25, porcentaje: 16.67},
+        {name: "S1", totals: rep.Items[0].Totals, solicitados: 100, sugeridos: 20, porcentaje: 20},
+        {name: "S2", totals: rep.Items[1].Totals, solicitados: 50, sugeridos: 5, porcentaje: 10},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := tt.totals
+            if got.TicketsConSolicitados != tt.solicitados || got.CombinacionesConSugeridos != tt.sugeridos {
+                t.Errorf("solicitados, sugeridos = %v, %v, want %v, %v", got.TicketsConSolicitados, got.CombinacionesConSugeridos, tt.solicitados, tt.sugeridos)
+            }
+            if got.PorcentajeBateo == nil || *got.PorcentajeBateo != tt.porcentaje {
+                t.Errorf("porcentajeBateo = %v, want %v", got.PorcentajeBateo, tt.porcentaje)
+            }
+        })
+    }
+}
+
+func TestQueryValidate(t *testing.T) {
+    tests := []struct {
+        name string
+        q    Query
+        ok   bool
+    }{
+        {name: "valid", q: Query{From: "2024-01-01", To: "2024-01-31"}, ok: true},
+        {name: "single day", q: Query{From: "2024-01-01", To: "2024-01-01"}, ok: true},
+        {name: "reversed", q: Query{From: "2024-01-31", To: "2024-01-01"}},
+        {name: "bad from", q: Query{From: "2024-1-1", To: "2024-01-31"}},
+        {name: "missing to", q: Query{From: "2024-01-01"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if err := tt.q.validate(); (err == nil) != tt.ok {
+                t.Fatalf("validate() = %v, want ok %v", err, tt.ok)
+            }
+        })
+    }
+}
@@ -0,0 +1,199 @@
+package analytics
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "time"
+)
+
+// Period is one side of a comparison: a calendar month, its totals and the
+// rows left out of them (see Report.ExcludedRows).
+type Period struct {
+    Month        string `json:"month"`
+    From         string `json:"from"`
+    To           string `json:"to"`
+    ExcludedRows int    `json:"excludedRows"`
+    Totals
+}
+
+// Change is the difference between two Totals. The percentages are
+// relative to the previous value and nil when it is zero.
+// PorcentajeBateo is the difference in percentage points, nil unless both
+// sides have one.
+type Change struct {
+    Importe                      float64  `json:"importe"`
+    ImportePct                   *float64 `json:"importePct"`
+    Unidades                     float64  `json:"unidades"`
+    UnidadesPct                  *float64 `json:"unidadesPct"`
+    Tickets                      int      `json:"tickets"`
+    TicketsPct                   *float64 `json:"ticketsPct"`
+    TicketsConSolicitados        float64  `json:"ticketsConSolicitados"`
+    TicketsConSolicitadosPct     *float64 `json:"ticketsConSolicitadosPct"`
+    CombinacionesConSugeridos    float64  `json:"combinacionesConSugeridos"`
+    CombinacionesConSugeridosPct *float64 `json:"combinacionesConSugeridosPct"`
+    PorcentajeBateo              *float64 `json:"porcentajeBateo"`
+}
+
+// Delta compares one branch or product across both periods.
+type Delta struct {
+    Sucursal string `json:"sucursal,omitempty"`
+    SKU      string `json:"sku,omitempty"`
+    Producto string `json:"producto,omitempty"`
+    Current  Totals `json:"current"`
+    Previous Totals `json:"previous"`
+    Change   Change `json:"change"`
+}
+
+// Comparison is a period-over-period report.
+type Comparison struct {
+    Current  Period  `json:"current"`
+    Previous Period  `json:"previous"`
+    Change   Change  `json:"change"`
+    Branches []Delta `json:"branches"`
+    Products []Delta `json:"products"`
+}
+
+// monthRange returns the first and last day of a YYYY-MM month.
+func monthRange(month string) (string, string, error) {
+    m, err := time.Parse("2006-01", month)
+    if err != nil {
+        return "", "", fmt.Errorf("%w: month %q is not YYYY-MM", ErrInvalidQuery, month)
+    }
+    return m.Format("2006-01-02"), m.AddDate(0, 1, -1).Format("2006-01-02"), nil
+}
+
+// PreviousMonth returns the month before a YYYY-MM month.
+func PreviousMonth(month string) (string, error) {
+    m, err := time.Parse("2006-01", month)
+    if err != nil {
+        return "", fmt.Errorf("%w: month %q is not YYYY-MM", ErrInvalidQuery, month)
+    }
+    return m.AddDate(0, -1, 0).Format("2006-01"), nil
+}
+
+// SameMonthLastYear returns the same month one year earlier.
+func SameMonthLastYear(month string) (string, error) {
+    m, err := time.Parse("2006-01", month)
+    if err != nil {
+        return "", fmt.Errorf("%w: month %q is not YYYY-MM", ErrInvalidQuery, month)
+    }
+    return m.AddDate(-1, 0, 0).Format("2006-01"), nil
+}
+
+// Compare reports the ventas of the current month against the previous
+// one, overall and per branch and product. Both sides are aggregated like
+// ByBranch and ByProduct.
+func Compare(dbPath, current, previous string) (Comparison, error) {
+    var c Comparison
+    sides := []*Period{&c.Current, &c.Previous}
+    reports := make([][2]Report, 2)
+    for i, month := range []string{current, previous} {
+        from, to, err := monthRange(month)
+        if err != nil {
+            return c, err
+        }
+        q := Query{From: from, To: to}
+        branches, err := ByBranch(dbPath, q)
+        if err != nil {
+            return c, err
+        }
+        products, err := ByProduct(dbPath, q, 0)
+        if err != nil {
+            return c, err
+        }
+        *sides[i] = Period{Month: month, From: from, To: to, ExcludedRows: branches.ExcludedRows, Totals: branches.Total}
+        reports[i] = [2]Report{branches, products}
+    }
+    c.Change = change(c.Current.Totals, c.Previous.Totals)
+    c.Branches = deltas(reports[0][0].Items, reports[1][0].Items, func(g Group) string { return g.Sucursal })
+    c.Products = deltas(reports[0][1].Items, reports[1][1].Items, func(g Group) string {
+        if g.SKU != "" {
+            return g.SKU
+        }
+        return g.Producto
+    })
+    return c, nil
+}
+
+// deltas pairs the groups of both periods by key. Groups missing from one
+// side compare against zero totals, and groups without a key (a Bateo
+// report has no products) are left out; their rows are still in the
+// period totals. Largest current importe (then tickets con solicitados)
+// first.
+func deltas(cur, prev []Group, key func(Group) string) []Delta {
+    byKey := map[string]*Delta{}
+    var order []string
+    add := func(g Group, current bool) {
+        k := key(g)
+        if k == "" {
+            return
+        }
+        d, ok := byKey[k]
+        if !ok {
+            d = &Delta{Sucursal: g.Sucursal, SKU: g.SKU, Producto: g.Producto}
+            byKey[k] = d
+            order = append(order, k)
+        }
+        if current {
+            d.Current = g.Totals
+        } else {
+            d.Previous = g.Totals
+        }
+    }
+    for _, g := range cur {
+        add(g, true)
+    }
+    for _, g := range prev {
+        add(g, false)
+    }
+    out := make([]Delta, 0, len(order))
+    for _, k := range order {
+        d := byKey[k]
+        d.Change = change(d.Current, d.Previous)
+        out = append(out, *d)
+    }
+    sort.SliceStable(out, func(i, j int) bool {
+        a, b := out[i].Current, out[j].Current
+        if a.Importe != b.Importe {
+            return a.Importe > b.Importe
+        }
+        return a.TicketsConSolicitados > b.TicketsConSolicitados
+    })
+    return out
+}
+
+func change(cur, prev Totals) Change {
+    return Change{
+        Importe:     cur.Importe - prev.Importe,
+        ImportePct:  pct(cur.Importe, prev.Importe),
+        Unidades:    cur.Unidades - prev.Unidades,
+        UnidadesPct: pct(cur.Unidades, prev.Unidades),
+        Tickets:     cur.Tickets - prev.Tickets,
+        TicketsPct:  pct(float64(cur.Tickets), float64(prev.Tickets)),
+
+        TicketsConSolicitados:        cur.TicketsConSolicitados - prev.TicketsConSolicitados,
+        TicketsConSolicitadosPct:     pct(cur.TicketsConSolicitados, prev.TicketsConSolicitados),
+        CombinacionesConSugeridos:    cur.CombinacionesConSugeridos - prev.CombinacionesConSugeridos,
+        CombinacionesConSugeridosPct: pct(cur.CombinacionesConSugeridos, prev.CombinacionesConSugeridos),
+        PorcentajeBateo:              points(cur.PorcentajeBateo, prev.PorcentajeBateo),
+    }
+}
+
+// points is the difference between two percentages, rounded to two decimals.
+func points(cur, prev *float64) *float64 {
+    if cur == nil || prev == nil {
+        return nil
+    }
+    p := math.Round((*cur-*prev)*100) / 100
+    return &p
+}
+
+// pct is the change from prev to cur in percent, rounded to two decimals.
+func pct(cur, prev float64) *float64 {
+    if prev == 0 {
+        return nil
+    }
+    p := math.Round((cur-prev)/prev*10000) / 100
+    return &p
+}
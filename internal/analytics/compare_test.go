@@ -0,0 +1,183 @@
+package analytics
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func TestMonths(t *testing.T) {
+    tests := []struct {
+        month                      string
+        wantFrom, wantTo           string
+        wantPrevious, wantLastYear string
+        wantErr                    bool
+    }{
+        {month: "2024-03", wantFrom: "2024-03-01", wantTo: "2024-03-31", wantPrevious: "2024-02", wantLastYear: "2023-03"},
+        {month: "2024-02", wantFrom: "2024-02-01", wantTo: "2024-02-29", wantPrevious: "2024-01", wantLastYear: "2023-02"},
+        {month: "2024-01", wantFrom: "2024-01-01", wantTo: "2024-01-31", wantPrevious: "2023-12", wantLastYear: "2023-01"},
+        {month: "2024-13", wantErr: true},
+        {month: "2024-03-01", wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.month, func(t *testing.T) {
+            from, to, err := monthRange(tt.month)
+            prev, errPrev := PreviousMonth(tt.month)
+            last, errLast := SameMonthLastYear(tt.month)
+            if tt.wantErr {
+                for _, err := range []error{err, errPrev, errLast} {
+                    if !errors.Is(err, ErrInvalidQuery) {
+                        t.Fatalf("err = %v, want ErrInvalidQuery", err)
+                    }
+                }
+                return
+            }
+            if err != nil || errPrev != nil || errLast != nil {
+                t.Fatalf("errors = %v, %v, %v", err, errPrev, errLast)
+            }
+            if from != tt.wantFrom || to != tt.wantTo || prev != tt.wantPrevious || last != tt.wantLastYear {
+                t.Fatalf("got %s..%s, previous %s, last year %s", from, to, prev, last)
+            }
+        })
+    }
+}
+
+func ptr(f float64) *float64 { return &f }
+
+func TestPctAndPoints(t *testing.T) {
+    tests := []struct {
+        name string
+        got  *float64
+        want *float64
+    }{
+        {name: "pct up", got: pct(150, 100), want: ptr(50)},
+        {name: "pct down", got: pct(2, 3), want: ptr(-33.33)},
+        {name: "pct from zero", got: pct(10, 0), want: nil},
+        {name: "pct to zero", got: pct(0, 70), want: ptr(-100)},
+        {name: "points", got: points(ptr(22.07), ptr(20.5)), want: ptr(1.57)},
+        {name: "points without current", got: points(nil, ptr(20.5)), want: nil},
+        {name: "points without previous", got: points(ptr(22.07), nil), want: nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if !reflect.DeepEqual(tt.got, tt.want) {
+                t.Fatalf("got %v, want %v", deref(tt.got), deref(tt.want))
+            }
+        })
+    }
+}
+
+func deref(p *float64) any {
+    if p == nil {
+        return nil
+    }
+    return *p
+}
+
+func TestDeltas(t *testing.T) {
+    cur := []Group{
+        {Sucursal: "S1", Totals: Totals{Importe: 10}},
+        {Sucursal: "S3", Totals: Totals{Importe: 50}},
+        {Totals: Totals{Importe: 99}},
+    }
+    prev := []Group{
+        {Sucursal: "S1", Totals: Totals{Importe: 20}},
+        {Sucursal: "S2", Totals: Totals{Importe: 5}},
+    }
+    got := deltas(cur, prev, func(g Group) string { return g.Sucursal })
+    tests := []struct {
+        sucursal   string
+        current    float64
+        previous   float64
+        importePct *float64
+    }{
+        // new branch, compared against zero
+        {sucursal: "S3", current: 50, previous: 0, importePct: nil},
+        {sucursal: "S1", current: 10, previous: 20, importePct: ptr(-50)},
+        // gone in the current period
+        {sucursal: "S2", current: 0, previous: 5, importePct: ptr(-100)},
+    }
+    if len(got) != len(tests) {
+        t.Fatalf("deltas = %+v, want %d entries without the empty key", got, len(tests))
+    }
+    for i, tt := range tests {
+        t.Run(tt.sucursal, func(t *testing.T) {
+            d := got[i]
+            if d.Sucursal != tt.sucursal || d.Current.Importe != tt.current || d.Previous.Importe != tt.previous {
+                t.Fatalf("delta %d = %s %v/%v, want %s %v/%v", i, d.Sucursal, d.Current.Importe, d.Previous.Importe, tt.sucursal, tt.current, tt.previous)
+            }
+            if d.Change.Importe != tt.current-tt.previous || !reflect.DeepEqual(d.Change.ImportePct, tt.importePct) {
+                t.Fatalf("change = %v (%v), want %v (%v)", d.Change.Importe, deref(d.Change.ImportePct), tt.current-tt.previous, deref(tt.importePct))
+            }
+        })
+    }
+}
+
+func TestCompare(t *testing.T) {
+    // March repeats folio T1 at two branches: two tickets
+    files := append(append([]testFile(nil), ventasFiles...), testFile{"2024-03-01", "2024-03-31",
+        "Sucursal,Fecha,Folio,SKU,Producto,Cantidad,Importe\n" +
+            "S1,05/03/2024,T1,A,Aspirina,1,10.00\n" +
+            "S2,05/03/2024,T1,A,Aspirina,1,10.00\n"})
+    dbPath := testDB(t, files)
+
+    type delta struct {
+        Key     string
+        Importe float64
+    }
+    tests := []struct {
+        name              string
+        current, previous string
+        wantChange        Change
+        wantBranches      []delta
+        wantProducts      []delta
+    }{
+        {
+            name:    "same folio at two branches",
+            current: "2024-03", previous: "2024-01",
+            wantChange: Change{
+                Importe: -50, ImportePct: ptr(-71.43),
+                Unidades: -5, UnidadesPct: ptr(-71.43),
+                Tickets: -1, TicketsPct: ptr(-33.33),
+            },
+            wantBranches: []delta{{"S1", -20}, {"S2", -30}},
+            wantProducts: []delta{{"A", -30}, {"B", -20}},
+        },
+        {
+            name:    "bateo month against a ventas month",
+            current: "2024-02", previous: "2024-01",
+            wantChange: Change{
+                Importe: -70, ImportePct: ptr(-100),
+                Unidades: -7, UnidadesPct: ptr(-100),
+                Tickets: -3, TicketsPct: ptr(-100),
+                TicketsConSolicitados: 150, CombinacionesConSugeridos: 25,
+            },
+            wantBranches: []delta{{"S1", -30}, {"S2", -40}},
+            wantProducts: []delta{{"A", -50}, {"B", -20}},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            c, err := Compare(dbPath, tt.current, tt.previous)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(c.Change, tt.wantChange) {
+                t.Errorf("change = %+v, want %+v", c.Change, tt.wantChange)
+            }
+            var branches, products []delta
+            for _, d := range c.Branches {
+                branches = append(branches, delta{d.Sucursal, d.Change.Importe})
+            }
+            for _, d := range c.Products {
+                products = append(products, delta{d.SKU, d.Change.Importe})
+            }
+            if !reflect.DeepEqual(branches, tt.wantBranches) {
+                t.Errorf("branches = %+v, want %+v", branches, tt.wantBranches)
+            }
+            if !reflect.DeepEqual(products, tt.wantProducts) {
+                t.Errorf("products = %+v, want %+v", products, tt.wantProducts)
+            }
+        })
+    }
+}
@@ -0,0 +1,122 @@
+package bateo
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "automation/api/internal/ingest"
+    "automation/api/internal/runner"
+)
+
+// MaxBackfillMonths bounds a single backfill request.
+const MaxBackfillMonths = 36
+
+// MonthProgress reports the state of one month of a backfill.
+type MonthProgress struct {
+    Month      string `json:"month"`
+    RangeStart string `json:"rangeStart"`
+    RangeEnd   string `json:"rangeEnd"`
+    Status     string `json:"status"` // pending | running | skipped | done | failed | canceled
+    BatchID    int64  `json:"batchId,omitempty"`
+    Rows       int    `json:"rows,omitempty"`
+    RunID      int64  `json:"runId,omitempty"`
+    Error      string `json:"error,omitempty"`
+}
+
+// BackfillMonths validates a from/to pair of YYYY-MM months and returns the
+// first day of each month in order. Only closed months (before now's month
+// in Location) can be backfilled.
+func BackfillMonths(from, to string, now time.Time) ([]time.Time, error) {
+    start, err := time.Parse("2006-01", from)
+    if err != nil {
+        return nil, fmt.Errorf("invalid from month %q (expected YYYY-MM)", from)
+    }
+    end, err := time.Parse("2006-01", to)
+    if err != nil {
+        return nil, fmt.Errorf("invalid to month %q (expected YYYY-MM)", to)
+    }
+    if end.Before(start) {
+        return nil, errors.New("from must not be after to")
+    }
+    t := today(now)
+    current := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+    if !end.Before(current) {
+        return nil, errors.New("to must be a closed month (before the current month)")
+    }
+    var months []time.Time
+    for m := start; !m.After(end); m = m.AddDate(0, 1, 0) {
+        months = append(months, m)
+        if len(months) > MaxBackfillMonths {
+            return nil, fmt.Errorf("at most %d months per backfill", MaxBackfillMonths)
+        }
+    }
+    return months, nil
+}
+
+// Backfill exports and ingests each month between from and to (YYYY-MM),
+// one after another, as an explicit range from the first to the last day of
+// the month. It does not export by query date: a date-based export for the
+// month's last day covers the month only up to the day before. The batches
+// therefore share their (range start, range end) key with a later explicit
+// range export of the same month, which reuses them from the cache. Months
+// that already have an ingested batch for their range are skipped unless
+// force is set. progress is called with the full list after every change.
+func (e *Exporter) Backfill(ctx context.Context, cred Request, from, to string, force bool, attach func(runner.Command) runner.Command, progress func([]MonthProgress)) ([]MonthProgress, error) {
+    months, err := BackfillMonths(from, to, time.Now())
+    if err != nil {
+        return nil, err
+    }
+    list := make([]MonthProgress, len(months))
+    for i, m := range months {
+        list[i] = MonthProgress{
+            Month:      m.Format("2006-01"),
+            RangeStart: m.Format("2006-01-02"),
+            RangeEnd:   m.AddDate(0, 1, -1).Format("2006-01-02"),
+            Status:     "pending",
+        }
+    }
+    report := func() {
+        if progress != nil {
+            progress(append([]MonthProgress(nil), list...))
+        }
+    }
+    report()
+
+    for i := range list {
+        p := &list[i]
+        if ctx.Err() != nil {
+            p.Status = "canceled"
+            continue
+        }
+        if !force {
+            if b, ok, err := ingest.LatestBatch(e.DBPath, p.RangeStart, p.RangeEnd); err == nil && ok {
+                p.Status, p.BatchID, p.Rows = "skipped", b.ID, b.Rows
+                report()
+                continue
+            }
+        }
+
+        p.Status = "running"
+        report()
+        req := cred
+        req.Start, req.End, req.Refresh = p.RangeStart, p.RangeEnd, true
+        exp, err := e.Export(ctx, req, attach)
+        p.RunID = exp.Result.RunID
+        switch {
+        case ctx.Err() != nil:
+            p.Status, p.Error = "canceled", "canceled"
+        case err != nil:
+            p.Status, p.Error = "failed", err.Error()
+        case !exp.Result.OK:
+            p.Status, p.Error = "failed", exp.Result.Error
+        case exp.Batch == nil:
+            p.Status, p.Error = "failed", exp.IngestError
+        default:
+            p.Status, p.BatchID, p.Rows = "done", exp.Batch.ID, exp.Batch.Rows
+        }
+        report()
+    }
+    return list, nil
+}
@@ -0,0 +1,72 @@
+package bateo
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "automation/api/internal/ingest"
+)
+
+// A month ingested by a backfill is found again, by the same range key, by
+// later exports of that month.
+func TestBackfillBatchReused(t *testing.T) {
+    root := t.TempDir()
+    e := NewExporter(root, filepath.Join(root, "erp.sqlite"))
+    months, err := BackfillMonths("2024-01", "2024-01", time.Now())
+    if err != nil {
+        t.Fatal(err)
+    }
+    rs, re := months[0].Format("2006-01-02"), months[0].AddDate(0, 1, -1).Format("2006-01-02")
+    if rs != "2024-01-01" || re != "2024-01-31" {
+        t.Fatalf("backfill range = %s..%s, want 2024-01-01..2024-01-31", rs, re)
+    }
+    dir := filepath.Join(root, "downloads")
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        t.Fatal(err)
+    }
+    file := filepath.Join(dir, "bateo_"+rs+"_a_"+re+".csv")
+    csv := "Sucursal,Fecha,Folio,Importe\nS1,15/01/2024,T1,100.00\n"
+    if err := os.WriteFile(file, []byte(csv), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    batch, err := ingest.IngestBateoExcel(e.DBPath, file, rs, re)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name   string
+        req    Request
+        reused bool
+    }{
+        {name: "explicit range", req: Request{Start: rs, End: re}, reused: true},
+        // a date-based export stops the day before the query date
+        {name: "query date on last day", req: Request{Date: re}, reused: false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            start, end, err := tt.req.Range(time.Now())
+            if err != nil {
+                t.Fatal(err)
+            }
+            exp, ok := e.cached(start, end, time.Now())
+            if ok != tt.reused {
+                t.Fatalf("cached(%s, %s) = %v, want %v", start, end, ok, tt.reused)
+            }
+            if ok && exp.Batch.ID != batch.ID {
+                t.Fatalf("cached batch = %d, want %d", exp.Batch.ID, batch.ID)
+            }
+        })
+    }
+
+    list, err := e.Backfill(context.Background(), Request{}, "2024-01", "2024-01", false, nil, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if p := list[0]; p.Status != "skipped" || p.BatchID != batch.ID {
+        t.Fatalf("backfill = %+v, want skipped with batch %d", p, batch.ID)
+    }
+}
@@ -0,0 +1,329 @@
+package bateo
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    "automation/api/internal/history"
+    "automation/api/internal/ingest"
+    "automation/api/internal/runner"
+)
+
+// ErrNoDownload is returned when the run succeeded but its output does not
+// say where the export was saved.
+var ErrNoDownload = errors.New("failed to determine downloaded file path")
+
+// ErrRangeMismatch is reported when the downloaded file is named after a
+// different range than the one requested.
+var ErrRangeMismatch = errors.New("downloaded file does not match the requested range")
+
+// Request identifies an export: ERP credentials plus either an explicit
+// Start/End range or a query date (YYYY-MM-DD, empty for today) from which
+// the month-to-date range is derived. Refresh skips the export cache.
+type Request struct {
+    BaseURL string
+    User    string
+    Pass    string
+    Date    string
+    Start   string
+    End     string
+    Refresh bool
+}
+
+// Range returns the effective range of the request, computed in Location.
+// Explicit ranges are validated with ValidateRange.
+func (r Request) Range(now time.Time) (string, string, error) {
+    start, end := strings.TrimSpace(r.Start), strings.TrimSpace(r.End)
+    if start != "" || end != "" {
+        if err := ValidateRange(start, end, now); err != nil {
+            return "", "", err
+        }
+        return start, end, nil
+    }
+    date := strings.TrimSpace(r.Date)
+    if date == "" {
+        date = today(now).Format("2006-01-02")
+    }
+    // rangeStart = first day of month, rangeEnd = day before the query date
+    return computeRange(date)
+}
+
+// Export describes the file produced by a bateo export run and the result
+// of ingesting it.
+type Export struct {
+    File        string            `json:"file"`
+    DB          string            `json:"db"`
+    Batch       *ingest.BatchInfo `json:"batch,omitempty"`
+    IngestError string            `json:"ingestError,omitempty"`
+    // Shared is set when the caller joined an export already in flight.
+    Shared bool `json:"shared,omitempty"`
+    // Cached is set when a previously ingested file was served without
+    // running the flow; Result is then a synthetic successful result.
+    Cached bool `json:"cached,omitempty"`
+    // Chunks lists the runs a large range was split into; Batch is then
+    // the parent batch of the chunk batches and File the merged download.
+    Chunks []Chunk `json:"chunks,omitempty"`
+    Result runner.ExecResult `json:"-"`
+}
+
+// Exporter runs the bateo export flow and ingests its output. Concurrent
+// requests for the same (baseUrl, user, range start, range end) share a
+// single run and ingest, and ranges already exported are served from the
+// downloads directory.
+type Exporter struct {
+    PlayRoot string
+    DBPath   string
+    // CacheTTL is how long an export of a range in the current month is
+    // reused. Ranges in closed months are reused indefinitely.
+    CacheTTL time.Duration
+    // ChunkDays is the largest range exported in one run; longer ranges
+    // are split into consecutive chunks. Zero disables chunking.
+    ChunkDays int
+
+    mu      sync.Mutex
+    flights map[flightKey]*flight
+}
+
+type flightKey struct {
+    baseURL, user, start, end string
+}
+
+type flight struct {
+    done    chan struct{}
+    exp     Export
+    err     error
+    waiters int
+    cancel  context.CancelFunc
+
+    // sinks holds the hooks of every caller waiting on the run, taken from
+    // its attach; output and queue/start notifications go to all of them.
+    mu      sync.Mutex
+    sinks   []*runner.Command
+    queued  int
+    started bool
+}
+
+// join registers the hooks set by attach and replays the current queue
+// position or start notification, so a caller joining late sees the same
+// state as the one that started the run.
+func (f *flight) join(attach func(runner.Command) runner.Command) *runner.Command {
+    c := &runner.Command{}
+    if attach != nil {
+        *c = attach(*c)
+    }
+    f.mu.Lock()
+    f.sinks = append(f.sinks, c)
+    started, queued := f.started, f.queued
+    f.mu.Unlock()
+    if started && c.OnStart != nil {
+        c.OnStart()
+    } else if queued > 0 && c.OnQueued != nil {
+        c.OnQueued(queued)
+    }
+    return c
+}
+
+func (f *flight) leave(c *runner.Command) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    for i, s := range f.sinks {
+        if s == c {
+            f.sinks = append(f.sinks[:i], f.sinks[i+1:]...)
+            return
+        }
+    }
+}
+
+// attach wires a runner command to every joined caller.
+func (f *flight) attach(c runner.Command) runner.Command {
+    c.Stdout = fanOut{f: f}
+    c.Stderr = fanOut{f: f, stderr: true}
+    c.OnQueued = func(position int) {
+        f.mu.Lock()
+        f.queued = position
+        sinks := append([]*runner.Command(nil), f.sinks...)
+        f.mu.Unlock()
+        for _, s := range sinks {
+            if s.OnQueued != nil {
+                s.OnQueued(position)
+            }
+        }
+    }
+    c.OnStart = func() {
+        f.mu.Lock()
+        f.started, f.queued = true, 0
+        sinks := append([]*runner.Command(nil), f.sinks...)
+        f.mu.Unlock()
+        for _, s := range sinks {
+            if s.OnStart != nil {
+                s.OnStart()
+            }
+        }
+    }
+    return c
+}
+
+// fanOut copies run output to the Stdout (or Stderr) of every joined caller.
+type fanOut struct {
+    f      *flight
+    stderr bool
+}
+
+func (o fanOut) Write(p []byte) (int, error) {
+    o.f.mu.Lock()
+    defer o.f.mu.Unlock()
+    for _, s := range o.f.sinks {
+        w := s.Stdout
+        if o.stderr {
+            w = s.Stderr
+        }
+        if w != nil {
+            w.Write(p)
+        }
+    }
+    return len(p), nil
+}
+
+func NewExporter(playRoot, dbPath string) *Exporter {
+    return &Exporter{PlayRoot: playRoot, DBPath: dbPath, ChunkDays: DefaultChunkDays, flights: map[flightKey]*flight{}}
+}
+
+// Export runs (or joins) the export for req. attach, if set, supplies the
+// hooks (output writers, queue and start callbacks) of this caller; every
+// caller waiting on a shared run gets its output and notifications. The run
+// is cancelled, and forgotten, once every caller waiting on it has gone away.
+//
+// The returned Export always carries the ExecResult; callers should check
+// Result.OK and Result.Err() before using the file.
+func (e *Exporter) Export(ctx context.Context, req Request, attach func(runner.Command) runner.Command) (Export, error) {
+    rs, re, err := req.Range(time.Now())
+    if err != nil {
+        return Export{Result: runner.ExecResult{Error: err.Error(), ExitCode: -1}}, err
+    }
+    key := flightKey{baseURL: req.BaseURL, user: req.User, start: rs, end: re}
+
+    if !req.Refresh {
+        if exp, ok := e.cached(rs, re, time.Now()); ok {
+            exp.Result = runner.ExecResult{OK: true}
+            return exp, nil
+        }
+    }
+
+    e.mu.Lock()
+    f, shared := e.flights[key]
+    if !shared {
+        runCtx, cancel := context.WithCancel(context.Background())
+        f = &flight{done: make(chan struct{}), cancel: cancel}
+        e.flights[key] = f
+        go func() {
+            f.exp, f.err = e.run(runCtx, req, rs, re, f.attach)
+            e.mu.Lock()
+            if e.flights[key] == f {
+                delete(e.flights, key)
+            }
+            e.mu.Unlock()
+            cancel()
+            close(f.done)
+        }()
+    }
+    f.waiters++
+    e.mu.Unlock()
+    sink := f.join(attach)
+    defer f.leave(sink)
+
+    select {
+    case <-f.done:
+        exp := f.exp
+        exp.Shared = shared
+        return exp, f.err
+    case <-ctx.Done():
+        e.mu.Lock()
+        f.waiters--
+        if f.waiters == 0 {
+            // a new request for the key starts a fresh run instead of
+            // joining this cancelled one
+            f.cancel()
+            if e.flights[key] == f {
+                delete(e.flights, key)
+            }
+        }
+        e.mu.Unlock()
+        return Export{Result: runner.ExecResult{Error: "canceled", ExitCode: -1}}, ctx.Err()
+    }
+}
+
+func (e *Exporter) run(ctx context.Context, req Request, rs, re string, attach func(runner.Command) runner.Command) (Export, error) {
+    if ranges := splitRange(rs, re, e.ChunkDays); ranges != nil {
+        return e.runChunked(ctx, req, rs, re, ranges, attach)
+    }
+    // the range computed here is the only one: the flow sets exactly these
+    // dates and names the file after them
+    cmd := runner.BateoExportCommand(req.BaseURL, req.User, req.Pass, strings.TrimSpace(req.Date), rs, re)
+    if attach != nil {
+        cmd = attach(cmd)
+    }
+    res := runner.Run(ctx, e.PlayRoot, cmd)
+    exp := Export{DB: e.DBPath, Result: res}
+    if !res.OK {
+        return exp, nil
+    }
+
+    exp.File = extractDownloadPath(res.Stdout)
+    if exp.File == "" {
+        return exp, ErrNoDownload
+    }
+    if err := checkDownloadRange(exp.File, rs, re); err != nil {
+        // the file is still served, but it is not ingested under a range
+        // it does not cover
+        log.Printf("bateo: %v", err)
+        exp.IngestError = err.Error()
+        return exp, nil
+    }
+    batch, err := ingest.IngestBateoExcel(e.DBPath, exp.File, rs, re)
+    if err != nil {
+        // ingest failures are reported, not returned, so the file can still be served
+        log.Printf("ingest error: %v", err)
+        exp.IngestError = err.Error()
+        return exp, nil
+    }
+    exp.Batch = &batch
+    if res.RunID != 0 {
+        if err := history.LinkBatch(e.DBPath, res.RunID, batch.ID); err != nil {
+            log.Printf("run history error: %v", err)
+        }
+    }
+    return exp, nil
+}
+
+// checkDownloadRange fails with ErrRangeMismatch unless file is named after
+// the range rs..re, as the flow names its downloads.
+func checkDownloadRange(file, rs, re string) error {
+    if !strings.Contains(filepath.Base(file), "_"+rs+"_a_"+re) {
+        return fmt.Errorf("%w: downloaded file %s, expected range %s..%s", ErrRangeMismatch, filepath.Base(file), rs, re)
+    }
+    return nil
+}
+
+func extractDownloadPath(stdout string) string {
+    // Looks for a line like: [DOWNLOAD] saved to: /abs/path/file.xlsx (12345 bytes)
+    lines := strings.Split(stdout, "\n")
+    for _, ln := range lines {
+        ln = strings.TrimSpace(ln)
+        if strings.HasPrefix(ln, "[DOWNLOAD] saved to:") {
+            // Split after the prefix
+            rest := strings.TrimSpace(strings.TrimPrefix(ln, "[DOWNLOAD] saved to:"))
+            // Rest may contain path plus size in parentheses; strip trailing size
+            if idx := strings.LastIndex(rest, " ("); idx != -1 {
+                rest = strings.TrimSpace(rest[:idx])
+            }
+            return rest
+        }
+    }
+    return ""
+}
@@ -0,0 +1,83 @@
+package bateo
+
+import (
+    "bytes"
+    "errors"
+    "testing"
+
+    "automation/api/internal/runner"
+)
+
+// Every caller joined to a flight gets the run's output and notifications,
+// including one that joins after the run started.
+func TestFlightFanOut(t *testing.T) {
+    f := &flight{done: make(chan struct{})}
+    type hooks struct {
+        out     bytes.Buffer
+        queued  int
+        started bool
+    }
+    hookOf := func(h *hooks) func(runner.Command) runner.Command {
+        return func(c runner.Command) runner.Command {
+            c.Stdout = &h.out
+            c.OnQueued = func(p int) { h.queued = p }
+            c.OnStart = func() { h.started = true }
+            return c
+        }
+    }
+    var first, second, late hooks
+    f.join(hookOf(&first))
+    cmd := f.attach(runner.Command{})
+    cmd.OnQueued(2)
+    f.join(hookOf(&second))
+    cmd.OnStart()
+    cmd.Stdout.Write([]byte("line\n"))
+    left := f.join(hookOf(&late))
+    f.leave(left)
+    cmd.Stdout.Write([]byte("after\n"))
+
+    tests := []struct {
+        name    string
+        h       *hooks
+        out     string
+        queued  int
+        started bool
+    }{
+        {name: "first", h: &first, out: "line\nafter\n", queued: 2, started: true},
+        {name: "joined while queued", h: &second, out: "line\nafter\n", queued: 2, started: true},
+        {name: "joined after start", h: &late, out: "", started: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.h.out.String(); got != tt.out {
+                t.Errorf("output = %q, want %q", got, tt.out)
+            }
+            if tt.h.queued != tt.queued {
+                t.Errorf("queued = %d, want %d", tt.h.queued, tt.queued)
+            }
+            if tt.h.started != tt.started {
+                t.Errorf("started = %v, want %v", tt.h.started, tt.started)
+            }
+        })
+    }
+}
+
+func TestCheckDownloadRange(t *testing.T) {
+    tests := []struct {
+        name    string
+        file    string
+        wantErr bool
+    }{
+        {name: "same range", file: "/d/REPORTE BATEO_2024-03-01_a_2024-03-13.xls"},
+        {name: "other end", file: "/d/REPORTE BATEO_2024-03-01_a_2024-03-12.xls", wantErr: true},
+        {name: "unnamed", file: "/d/REPORTE BATEO.xls", wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := checkDownloadRange(tt.file, "2024-03-01", "2024-03-13")
+            if tt.wantErr != errors.Is(err, ErrRangeMismatch) {
+                t.Fatalf("checkDownloadRange(%q) = %v, wantErr %v", tt.file, err, tt.wantErr)
+            }
+        })
+    }
+}
@@ -0,0 +1,52 @@
+package bateo
+
+import (
+    "os"
+    "path/filepath"
+    "time"
+
+    "automation/api/internal/ingest"
+)
+
+// cached looks for an already ingested export of [rangeStart, rangeEnd]
+// whose file is still in the downloads directory. Ranges that end before
+// the current month never expire; ranges touching the current month are
+// served for CacheTTL after ingest. A zero CacheTTL disables the cache for
+// the current month only.
+func (e *Exporter) cached(rangeStart, rangeEnd string, now time.Time) (Export, bool) {
+    batch, ok, err := ingest.LatestBatch(e.DBPath, rangeStart, rangeEnd)
+    if err != nil || !ok {
+        return Export{}, false
+    }
+    if !rangeClosed(rangeEnd, now) {
+        created, err := time.Parse(time.RFC3339, batch.CreatedAt)
+        if err != nil || now.Sub(created) > e.CacheTTL {
+            return Export{}, false
+        }
+    }
+    file := filepath.Join(e.downloadsDir(), batch.Filename)
+    if fi, err := os.Stat(file); err != nil || fi.IsDir() {
+        return Export{}, false
+    }
+    return Export{File: file, DB: e.DBPath, Batch: &batch, Cached: true}, true
+}
+
+// rangeClosed reports whether a range ending on rangeEnd lies entirely in a
+// month before now's month (in Location), so its report can no longer change.
+func rangeClosed(rangeEnd string, now time.Time) bool {
+    end, err := time.Parse("2006-01-02", rangeEnd)
+    if err != nil {
+        return false
+    }
+    t := today(now)
+    monthStart := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+    return end.Before(monthStart)
+}
+
+func (e *Exporter) downloadsDir() string {
+    abs, err := filepath.Abs(filepath.Join(e.PlayRoot, "downloads"))
+    if err != nil {
+        return filepath.Join(e.PlayRoot, "downloads")
+    }
+    return abs
+}
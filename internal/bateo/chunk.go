@@ -0,0 +1,220 @@
+package bateo
+
+import (
+    "context"
+    "encoding/csv"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/xuri/excelize/v2"
+
+    "automation/api/internal/history"
+    "automation/api/internal/ingest"
+    "automation/api/internal/runner"
+)
+
+// DefaultChunkDays is the largest range exported in a single run unless
+// Exporter.ChunkDays says otherwise.
+const DefaultChunkDays = 31
+
+// Chunk is one export run of a range that was split into several.
+type Chunk struct {
+    RangeStart string            `json:"rangeStart"`
+    RangeEnd   string            `json:"rangeEnd"`
+    File       string            `json:"file,omitempty"`
+    RunID      int64             `json:"runId,omitempty"`
+    Batch      *ingest.BatchInfo `json:"batch,omitempty"`
+}
+
+// splitRange cuts [rs, re] into consecutive ranges of at most days days.
+// It returns nil when the range fits in one chunk.
+func splitRange(rs, re string, days int) [][2]string {
+    if days <= 0 {
+        return nil
+    }
+    s, err1 := time.Parse("2006-01-02", rs)
+    e, err2 := time.Parse("2006-01-02", re)
+    if err1 != nil || err2 != nil || int(e.Sub(s).Hours()/24)+1 <= days {
+        return nil
+    }
+    var out [][2]string
+    for cs := s; !cs.After(e); cs = cs.AddDate(0, 0, days) {
+        ce := cs.AddDate(0, 0, days-1)
+        if ce.After(e) {
+            ce = e
+        }
+        out = append(out, [2]string{cs.Format("2006-01-02"), ce.Format("2006-01-02")})
+    }
+    return out
+}
+
+// runChunked exports each chunk in turn, merges the downloads into a single
+// file for [rs, re] and ingests every chunk as a child of one parent batch.
+// Nothing is ingested unless every chunk downloaded, is named after its
+// range and ingests without error.
+func (e *Exporter) runChunked(ctx context.Context, req Request, rs, re string, ranges [][2]string, attach func(runner.Command) runner.Command) (Export, error) {
+    exp := Export{DB: e.DBPath}
+    combined := runner.ExecResult{OK: true}
+    var stdout, stderr strings.Builder
+
+    for _, r := range ranges {
+        cmd := runner.BateoExportCommand(req.BaseURL, req.User, req.Pass, "", r[0], r[1])
+        if attach != nil {
+            cmd = attach(cmd)
+        }
+        res := runner.Run(ctx, e.PlayRoot, cmd)
+        if combined.Command == "" {
+            combined.Command, combined.Args, combined.StartedAt = res.Command, res.Args, res.StartedAt
+        }
+        combined.DurationMs += res.DurationMs
+        stdout.WriteString(res.Stdout)
+        stderr.WriteString(res.Stderr)
+        c := Chunk{RangeStart: r[0], RangeEnd: r[1], RunID: res.RunID}
+        if !res.OK {
+            exp.Chunks = append(exp.Chunks, c)
+            res.Stdout, res.Stderr = stdout.String(), stderr.String()
+            exp.Result = res
+            return exp, nil
+        }
+        c.File = extractDownloadPath(res.Stdout)
+        exp.Chunks = append(exp.Chunks, c)
+        if c.File == "" {
+            exp.Result = res
+            return exp, ErrNoDownload
+        }
+    }
+    combined.Stdout, combined.Stderr = stdout.String(), stderr.String()
+    exp.Result = combined
+
+    files := make([]string, len(exp.Chunks))
+    chunks := make([]ingest.Chunk, len(exp.Chunks))
+    for i, c := range exp.Chunks {
+        files[i] = c.File
+        chunks[i] = ingest.Chunk{Path: c.File, RangeStart: c.RangeStart, RangeEnd: c.RangeEnd}
+    }
+    // name the merged file like the flow names its downloads:
+    // <report>_<start>_a_<end>
+    first := exp.Chunks[0]
+    name := strings.TrimSuffix(filepath.Base(first.File), filepath.Ext(first.File))
+    name = strings.TrimSuffix(name, "_"+first.RangeStart+"_a_"+first.RangeEnd)
+    merged, err := mergeExports(files, e.downloadsDir(), name+"_"+rs+"_a_"+re)
+    if err != nil {
+        return exp, fmt.Errorf("merge chunks: %w", err)
+    }
+    exp.File = merged
+
+    for _, c := range exp.Chunks {
+        if err := checkDownloadRange(c.File, c.RangeStart, c.RangeEnd); err != nil {
+            log.Printf("bateo: %v", err)
+            exp.IngestError = err.Error()
+            return exp, nil
+        }
+    }
+    parent, batches, err := ingest.IngestChunks(e.DBPath, rs, re, merged, chunks)
+    if err != nil {
+        log.Printf("ingest error: %v", err)
+        exp.IngestError = err.Error()
+        return exp, nil
+    }
+    exp.Batch = &parent
+    // batches is empty when the merged file was a duplicate: its chunks
+    // are in already
+    for i := range batches {
+        c := &exp.Chunks[i]
+        c.Batch = &batches[i]
+        if c.RunID != 0 {
+            if err := history.LinkBatch(e.DBPath, c.RunID, c.Batch.ID); err != nil {
+                log.Printf("run history error: %v", err)
+            }
+        }
+    }
+    return exp, nil
+}
+
+// mergeExports writes the detail rows of each file (see ingest.ReadTable)
+// to dir/name under a single header row. Columns are lined up by data key:
+// the header of the first file comes first, then any column only a later
+// file has. The result is a CSV when every input is a CSV and an XLSX
+// otherwise.
+func mergeExports(files []string, dir, name string) (string, error) {
+    var (
+        header []string
+        index  = map[string]int{}
+        tables []ingest.Table
+    )
+    allCSV := true
+    for _, f := range files {
+        t, err := ingest.ReadTable(f, ingest.DefaultReportType)
+        if err != nil {
+            return "", fmt.Errorf("%s: %w", filepath.Base(f), err)
+        }
+        for i, k := range t.Keys {
+            if _, ok := index[k]; !ok {
+                index[k] = len(header)
+                header = append(header, t.Header[i])
+            }
+        }
+        tables = append(tables, t)
+        if strings.ToLower(filepath.Ext(f)) != ".csv" {
+            allCSV = false
+        }
+    }
+    var rows [][]string
+    if len(header) > 0 {
+        rows = append(rows, header)
+    }
+    for _, t := range tables {
+        for _, r := range t.Rows {
+            out := make([]string, len(header))
+            for i, k := range t.Keys {
+                if i < len(r) {
+                    out[index[k]] = r[i]
+                }
+            }
+            rows = append(rows, out)
+        }
+    }
+
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return "", err
+    }
+    if allCSV {
+        out := filepath.Join(dir, name+".csv")
+        f, err := os.Create(out)
+        if err != nil {
+            return "", err
+        }
+        w := csv.NewWriter(f)
+        if err := w.WriteAll(rows); err != nil {
+            f.Close()
+            return "", err
+        }
+        return out, f.Close()
+    }
+
+    out := filepath.Join(dir, name+".xlsx")
+    x := excelize.NewFile()
+    defer func() { _ = x.Close() }()
+    sheet := x.GetSheetName(0)
+    for i, r := range rows {
+        cell, err := excelize.CoordinatesToCellName(1, i+1)
+        if err != nil {
+            return "", err
+        }
+        vals := make([]any, len(r))
+        for j, v := range r {
+            vals[j] = v
+        }
+        if err := x.SetSheetRow(sheet, cell, &vals); err != nil {
+            return "", err
+        }
+    }
+    if err := x.SaveAs(out); err != nil {
+        return "", err
+    }
+    return out, nil
+}
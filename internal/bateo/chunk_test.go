@@ -0,0 +1,75 @@
+package bateo
+
+import (
+    "encoding/csv"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestMergeExports(t *testing.T) {
+    tests := []struct {
+        name  string
+        files []string
+        want  [][]string
+    }{
+        {
+            name: "bannered files",
+            files: []string{
+                "REPORTE BATEO,,\nDel 01/01/2024 al 31/01/2024,,\n,,\nSucursal,Folio,Importe\nS1,T1,10.00\nS2,T2,20.00\nTotal,,30.00\n",
+                "REPORTE BATEO,,\nDel 01/02/2024 al 29/02/2024,,\nSucursal,Folio,Importe\nS1,T3,5.00\n,,\nSubtotal S1,,5.00\nGran Total,,5.00\n",
+            },
+            want: [][]string{
+                {"Sucursal", "Folio", "Importe"},
+                {"S1", "T1", "10.00"},
+                {"S2", "T2", "20.00"},
+                {"S1", "T3", "5.00"},
+            },
+        },
+        {
+            name: "columns lined up by key",
+            files: []string{
+                "Sucursal,Folio,Importe\nS1,T1,10.00\n",
+                "REPORTE BATEO,\nFolio,Tienda,Importe,Vendedor\nT2,S2,20.00,Ana\n",
+            },
+            want: [][]string{
+                {"Sucursal", "Folio", "Importe", "Vendedor"},
+                {"S1", "T1", "10.00", ""},
+                {"S2", "T2", "20.00", "Ana"},
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            var files []string
+            for i, body := range tt.files {
+                f := filepath.Join(dir, "chunk"+string(rune('a'+i))+".csv")
+                if err := os.WriteFile(f, []byte(body), 0o644); err != nil {
+                    t.Fatal(err)
+                }
+                files = append(files, f)
+            }
+            out, err := mergeExports(files, dir, "merged")
+            if err != nil {
+                t.Fatal(err)
+            }
+            if filepath.Ext(out) != ".csv" {
+                t.Fatalf("merged file = %s, want a .csv", out)
+            }
+            f, err := os.Open(out)
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer f.Close()
+            got, err := csv.NewReader(f).ReadAll()
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Fatalf("merged rows = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
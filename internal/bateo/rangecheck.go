@@ -0,0 +1,91 @@
+package bateo
+
+import (
+    "errors"
+    "fmt"
+    "time"
+    _ "time/tzdata"
+)
+
+// DefaultTimezone is the ERP's business timezone.
+const DefaultTimezone = "America/Mexico_City"
+
+// Location is the timezone in which "today", month boundaries and default
+// ranges are computed. Every range is computed here once and passed to the
+// Node flow as RANGE_START/RANGE_END, so the flow never derives its own.
+var Location = mustLoadLocation(DefaultTimezone)
+
+// SetTimezone changes Location.
+func SetTimezone(name string) error {
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+        return err
+    }
+    Location = loc
+    return nil
+}
+
+func mustLoadLocation(name string) *time.Location {
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+        return time.UTC
+    }
+    return loc
+}
+
+// today returns now's calendar date in Location as midnight UTC, the form
+// used for YYYY-MM-DD arithmetic in this package.
+func today(now time.Time) time.Time {
+    y, m, d := now.In(Location).Date()
+    return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// MaxRangeDays bounds an explicit start/end range.
+var MaxRangeDays = 366
+
+// ErrInvalidRange wraps every range validation failure.
+var ErrInvalidRange = errors.New("invalid date range")
+
+// ValidateRange checks an explicit YYYY-MM-DD range: both ends present,
+// start <= end, end not after today (in Location) and at most MaxRangeDays
+// days long.
+func ValidateRange(start, end string, now time.Time) error {
+    if start == "" || end == "" {
+        return fmt.Errorf("%w: start and end are both required", ErrInvalidRange)
+    }
+    s, err := time.Parse("2006-01-02", start)
+    if err != nil {
+        return fmt.Errorf("%w: start %q is not YYYY-MM-DD", ErrInvalidRange, start)
+    }
+    e, err := time.Parse("2006-01-02", end)
+    if err != nil {
+        return fmt.Errorf("%w: end %q is not YYYY-MM-DD", ErrInvalidRange, end)
+    }
+    if e.Before(s) {
+        return fmt.Errorf("%w: start must not be after end", ErrInvalidRange)
+    }
+    if e.After(today(now)) {
+        return fmt.Errorf("%w: end must not be in the future", ErrInvalidRange)
+    }
+    if days := int(e.Sub(s).Hours()/24) + 1; days > MaxRangeDays {
+        return fmt.Errorf("%w: %d days exceeds the maximum of %d", ErrInvalidRange, days, MaxRangeDays)
+    }
+    return nil
+}
+
+// computeRange returns (start, end) for the given YYYY-MM-DD query date
+// where start is the first day of its month and end is the day before the
+// date (clamped to start on the 1st), formatted as YYYY-MM-DD.
+func computeRange(dateStr string) (string, string, error) {
+    t, err := time.Parse("2006-01-02", dateStr)
+    if err != nil {
+        return "", "", fmt.Errorf("%w: date %q is not YYYY-MM-DD", ErrInvalidRange, dateStr)
+    }
+    start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+    // Range end is the day before the consultation day
+    end := t.AddDate(0, 0, -1)
+    if end.Before(start) {
+        end = start
+    }
+    return start.Format("2006-01-02"), end.Format("2006-01-02"), nil
+}
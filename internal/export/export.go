@@ -0,0 +1,147 @@
+package export
+
+import (
+    "bufio"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+
+    "github.com/xuri/excelize/v2"
+
+    "automation/api/internal/ingest"
+)
+
+// Formats lists the supported output formats with their content types.
+var Formats = map[string]string{
+    "csv":     "text/csv; charset=utf-8",
+    "xlsx":    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+    "ndjson":  "application/x-ndjson",
+    "parquet": "application/vnd.apache.parquet",
+}
+
+// Rows feeds every row to fn, stopping at the first error.
+type Rows func(fn func(ingest.Row) error) error
+
+// Write renders the rows as format, one column per cols entry and the
+// column names as headers (CSV, XLSX) or keys (NDJSON).
+func Write(w io.Writer, format string, cols []ingest.Column, rows Rows) error {
+    switch format {
+    case "csv":
+        return writeCSV(w, cols, rows)
+    case "xlsx":
+        return writeXLSX(w, cols, rows)
+    case "ndjson":
+        return writeNDJSON(w, cols, rows)
+    case "parquet":
+        return writeParquet(w, cols, rows)
+    default:
+        return fmt.Errorf("unsupported format %q", format)
+    }
+}
+
+func writeCSV(w io.Writer, cols []ingest.Column, rows Rows) error {
+    cw := csv.NewWriter(w)
+    rec := make([]string, len(cols))
+    for i, c := range cols {
+        rec[i] = c.Name
+    }
+    if err := cw.Write(rec); err != nil {
+        return err
+    }
+    err := rows(func(r ingest.Row) error {
+        for i, c := range cols {
+            rec[i] = text(c.Value(r))
+        }
+        return cw.Write(rec)
+    })
+    if err != nil {
+        return err
+    }
+    cw.Flush()
+    return cw.Error()
+}
+
+func writeNDJSON(w io.Writer, cols []ingest.Column, rows Rows) error {
+    bw := bufio.NewWriter(w)
+    keys := make([][]byte, len(cols))
+    for i, c := range cols {
+        k, err := json.Marshal(c.Name)
+        if err != nil {
+            return err
+        }
+        keys[i] = append(k, ':')
+    }
+    // objects are written by hand so keys keep the column order
+    err := rows(func(r ingest.Row) error {
+        bw.WriteByte('{')
+        for i, c := range cols {
+            if i > 0 {
+                bw.WriteByte(',')
+            }
+            v, err := json.Marshal(c.Value(r))
+            if err != nil {
+                return err
+            }
+            bw.Write(keys[i])
+            bw.Write(v)
+        }
+        _, err := bw.WriteString("}\n")
+        return err
+    })
+    if err != nil {
+        return err
+    }
+    return bw.Flush()
+}
+
+func writeXLSX(w io.Writer, cols []ingest.Column, rows Rows) error {
+    f := excelize.NewFile()
+    defer func() { _ = f.Close() }()
+    sw, err := f.NewStreamWriter(f.GetSheetName(0))
+    if err != nil {
+        return err
+    }
+    header := make([]any, len(cols))
+    for i, c := range cols {
+        header[i] = c.Name
+    }
+    if err := sw.SetRow("A1", header); err != nil {
+        return err
+    }
+    n := 1
+    err = rows(func(r ingest.Row) error {
+        n++
+        vals := make([]any, len(cols))
+        for i, c := range cols {
+            vals[i] = c.Value(r)
+        }
+        cell, err := excelize.CoordinatesToCellName(1, n)
+        if err != nil {
+            return err
+        }
+        return sw.SetRow(cell, vals)
+    })
+    if err != nil {
+        return err
+    }
+    if err := sw.Flush(); err != nil {
+        return err
+    }
+    return f.Write(w)
+}
+
+// text formats a normalized value for text outputs.
+func text(v any) string {
+    switch x := v.(type) {
+    case nil:
+        return ""
+    case string:
+        return x
+    case float64:
+        return strconv.FormatFloat(x, 'f', -1, 64)
+    default:
+        return fmt.Sprint(x)
+    }
+}
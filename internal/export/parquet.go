@@ -0,0 +1,59 @@
+package export
+
+import (
+    "fmt"
+    "io"
+    "reflect"
+
+    "github.com/parquet-go/parquet-go"
+
+    "automation/api/internal/ingest"
+)
+
+// parquetRowGroupRows bounds how many rows go in one row group.
+const parquetRowGroupRows = 50000
+
+// parquetSchema describes cols as optional columns, DOUBLE for numeric
+// columns and UTF8 strings for the rest. It is built from a struct type
+// because parquet.Group would sort the columns by name.
+func parquetSchema(cols []ingest.Column) *parquet.Schema {
+    fields := make([]reflect.StructField, len(cols))
+    for i, c := range cols {
+        typ := reflect.TypeOf((*string)(nil))
+        if c.Numeric() {
+            typ = reflect.TypeOf((*float64)(nil))
+        }
+        fields[i] = reflect.StructField{
+            Name: fmt.Sprintf("F%d", i),
+            Type: typ,
+            Tag:  reflect.StructTag(fmt.Sprintf(`parquet:"%s,optional"`, c.Name)),
+        }
+    }
+    return parquet.SchemaOf(reflect.New(reflect.StructOf(fields)).Elem().Interface())
+}
+
+func writeParquet(w io.Writer, cols []ingest.Column, rows Rows) error {
+    pw := parquet.NewWriter(w, parquetSchema(cols),
+        parquet.MaxRowsPerRowGroup(parquetRowGroupRows),
+        parquet.CreatedBy("automation/api", "", ""))
+    row := make(parquet.Row, len(cols))
+    err := rows(func(r ingest.Row) error {
+        for i, c := range cols {
+            v := c.Value(r)
+            if v == nil {
+                row[i] = parquet.NullValue().Level(0, 0, i)
+                continue
+            }
+            if !c.Numeric() {
+                v = text(v)
+            }
+            row[i] = parquet.ValueOf(v).Level(0, 1, i)
+        }
+        _, err := pw.WriteRows([]parquet.Row{row})
+        return err
+    })
+    if err != nil {
+        return err
+    }
+    return pw.Close()
+}
@@ -0,0 +1,243 @@
+package history
+
+import (
+    "bytes"
+    "compress/gzip"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    _ "modernc.org/sqlite"
+
+    "automation/api/internal/runner"
+)
+
+// MaxOutputBytes caps how much of stdout/stderr is kept per run. Longer
+// output keeps its tail, which is where failures are reported.
+const MaxOutputBytes = 1 << 20
+
+var ErrNotFound = errors.New("run not found")
+
+type Run struct {
+    ID         int64     `json:"id"`
+    StartedAt  string    `json:"startedAt"`
+    Command    string    `json:"command"`
+    Args       []string  `json:"args"`
+    OK         bool      `json:"ok"`
+    ExitCode   int       `json:"exitCode"`
+    DurationMs int64     `json:"durationMs"`
+    Error      string    `json:"error,omitempty"`
+    Truncated  bool      `json:"truncated,omitempty"`
+    BatchID    *int64    `json:"batchId,omitempty"`
+    Stdout     string    `json:"stdout,omitempty"`
+    Stderr     string    `json:"stderr,omitempty"`
+    Tests      []runner.TestCase `json:"tests,omitempty"`
+}
+
+// Filter narrows List results. Zero values mean no filter.
+type Filter struct {
+    OK     *bool
+    Limit  int
+    Offset int
+}
+
+func openDB(dbPath string) (*sql.DB, error) {
+    if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+        return nil, err
+    }
+    // busy_timeout lets concurrent runs and ingests wait for the write lock
+    return sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
+}
+
+func initSchema(db *sql.DB) error {
+    stmts := []string{
+        `CREATE TABLE IF NOT EXISTS runs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            started_at  TEXT NOT NULL,
+            command     TEXT NOT NULL,
+            args_json   TEXT NOT NULL,
+            ok          INTEGER NOT NULL,
+            exit_code   INTEGER NOT NULL,
+            duration_ms INTEGER NOT NULL,
+            error       TEXT NOT NULL DEFAULT '',
+            stdout_gz   BLOB,
+            stderr_gz   BLOB,
+            truncated   INTEGER NOT NULL DEFAULT 0,
+            batch_id    INTEGER,
+            FOREIGN KEY(batch_id) REFERENCES ingest_batches(id)
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_runs_started ON runs(started_at);`,
+    }
+    for _, s := range stmts {
+        if _, err := db.Exec(s); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Record stores a finished run and returns its ID.
+func Record(dbPath string, res runner.ExecResult) (int64, error) {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return 0, err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return 0, err
+    }
+
+    stdout, t1 := truncateTail(res.Stdout)
+    stderr, t2 := truncateTail(res.Stderr)
+    outGz, err := compress(stdout)
+    if err != nil {
+        return 0, err
+    }
+    errGz, err := compress(stderr)
+    if err != nil {
+        return 0, err
+    }
+    args, _ := json.Marshal(res.Args)
+    started := res.StartedAt
+    if started.IsZero() {
+        started = time.Now()
+    }
+
+    r, err := db.Exec(`INSERT INTO runs(started_at, command, args_json, ok, exit_code, duration_ms, error, stdout_gz, stderr_gz, truncated) VALUES(?,?,?,?,?,?,?,?,?,?)`,
+        started.UTC().Format(time.RFC3339), res.Command, string(args), res.OK, res.ExitCode, res.DurationMs, res.Error, outGz, errGz, t1 || t2)
+    if err != nil {
+        return 0, err
+    }
+    return r.LastInsertId()
+}
+
+// LinkBatch records the ingest batch a run produced.
+func LinkBatch(dbPath string, runID, batchID int64) error {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return err
+    }
+    _, err = db.Exec(`UPDATE runs SET batch_id = ? WHERE id = ?`, batchID, runID)
+    return err
+}
+
+// List returns runs newest first without their output.
+func List(dbPath string, f Filter) ([]Run, error) {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return nil, err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return nil, err
+    }
+
+    q := `SELECT id, started_at, command, args_json, ok, exit_code, duration_ms, error, truncated, batch_id FROM runs`
+    var args []any
+    if f.OK != nil {
+        q += ` WHERE ok = ?`
+        args = append(args, *f.OK)
+    }
+    limit := f.Limit
+    if limit <= 0 || limit > 500 {
+        limit = 50
+    }
+    q += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+    args = append(args, limit, f.Offset)
+
+    rows, err := db.Query(q, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    out := []Run{}
+    for rows.Next() {
+        var r Run
+        var argsJSON string
+        if err := rows.Scan(&r.ID, &r.StartedAt, &r.Command, &argsJSON, &r.OK, &r.ExitCode, &r.DurationMs, &r.Error, &r.Truncated, &r.BatchID); err != nil {
+            return nil, err
+        }
+        _ = json.Unmarshal([]byte(argsJSON), &r.Args)
+        out = append(out, r)
+    }
+    return out, rows.Err()
+}
+
+// Get returns a single run including its stdout and stderr.
+func Get(dbPath string, id int64) (Run, error) {
+    var r Run
+    db, err := openDB(dbPath)
+    if err != nil {
+        return r, err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return r, err
+    }
+
+    var argsJSON string
+    var outGz, errGz []byte
+    err = db.QueryRow(`SELECT id, started_at, command, args_json, ok, exit_code, duration_ms, error, truncated, batch_id, stdout_gz, stderr_gz FROM runs WHERE id = ?`, id).
+        Scan(&r.ID, &r.StartedAt, &r.Command, &argsJSON, &r.OK, &r.ExitCode, &r.DurationMs, &r.Error, &r.Truncated, &r.BatchID, &outGz, &errGz)
+    if errors.Is(err, sql.ErrNoRows) {
+        return r, ErrNotFound
+    }
+    if err != nil {
+        return r, err
+    }
+    _ = json.Unmarshal([]byte(argsJSON), &r.Args)
+    if r.Stdout, err = decompress(outGz); err != nil {
+        return r, err
+    }
+    if r.Stderr, err = decompress(errGz); err != nil {
+        return r, err
+    }
+    r.Tests = runner.ParseTests(r.Stdout)
+    return r, nil
+}
+
+func truncateTail(s string) (string, bool) {
+    if len(s) <= MaxOutputBytes {
+        return s, false
+    }
+    s = s[len(s)-MaxOutputBytes:]
+    // drop the partial first line
+    if i := strings.IndexByte(s, '\n'); i != -1 {
+        s = s[i+1:]
+    }
+    return "[... truncated ...]\n" + s, true
+}
+
+func compress(s string) ([]byte, error) {
+    var buf bytes.Buffer
+    zw := gzip.NewWriter(&buf)
+    if _, err := zw.Write([]byte(s)); err != nil {
+        return nil, err
+    }
+    if err := zw.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func decompress(b []byte) (string, error) {
+    if len(b) == 0 {
+        return "", nil
+    }
+    zr, err := gzip.NewReader(bytes.NewReader(b))
+    if err != nil {
+        return "", err
+    }
+    defer zr.Close()
+    out, err := io.ReadAll(zr)
+    return string(out), err
+}
@@ -0,0 +1,508 @@
+package ingest
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// ErrBatchNotFound is returned for unknown batch IDs.
+var ErrBatchNotFound = errors.New("batch not found")
+
+// ErrUnknownColumn is returned when a row filter names a column the batch
+// does not have.
+var ErrUnknownColumn = errors.New("unknown column")
+
+// batchSelect reads a BatchInfo with scanBatch. Rows of a parent batch
+// include the rows of its chunks.
+const batchSelect = `SELECT b.id, b.range_start, b.range_end, b.filename, b.created_at, b.parent_id,
+        b.report_type, b.meta_json, b.sha256, b.size, b.supersedes_id,
+        (SELECT COUNT(*) FROM bateo_ventas_rows r
+            WHERE r.batch_id = b.id
+               OR r.batch_id IN (SELECT c.id FROM ingest_batches c WHERE c.parent_id = b.id)),
+        (SELECT COUNT(*) FROM batch_totals t WHERE t.batch_id = b.id)
+    FROM ingest_batches b`
+
+type scanner interface {
+    Scan(dest ...any) error
+}
+
+func scanBatch(sc scanner) (BatchInfo, error) {
+    var (
+        info       BatchInfo
+        parent     sql.NullInt64
+        reportType sql.NullString
+        meta       sql.NullString
+        sum        sql.NullString
+        size       sql.NullInt64
+        supersedes sql.NullInt64
+    )
+    err := sc.Scan(&info.ID, &info.RangeStart, &info.RangeEnd, &info.Filename, &info.CreatedAt, &parent,
+        &reportType, &meta, &sum, &size, &supersedes, &info.Rows, &info.TotalRows)
+    if err != nil {
+        return info, err
+    }
+    info.ParentID = parent.Int64
+    info.ReportType = reportType.String
+    info.SHA256, info.Size = sum.String, size.Int64
+    info.Supersedes = supersedes.Int64
+    if meta.Valid {
+        var m batchMeta
+        if json.Unmarshal([]byte(meta.String), &m) == nil {
+            info.Unmapped, info.MissingRequired = m.Unmapped, m.MissingRequired
+            info.HeaderRow, info.Preamble, info.Locale = m.HeaderRow, m.Preamble, m.Locale
+            info.Columns = m.Columns
+        }
+    }
+    return info, nil
+}
+
+func getBatch(db *sql.DB, id int64) (BatchInfo, error) {
+    info, err := scanBatch(db.QueryRow(batchSelect+` WHERE b.id = ?`, id))
+    if errors.Is(err, sql.ErrNoRows) {
+        return info, ErrBatchNotFound
+    }
+    return info, err
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+    QueryRow(query string, args ...any) *sql.Row
+}
+
+// latestBatch returns the newest top-level batch (not a chunk) of a range.
+func latestBatch(q querier, rangeStart, rangeEnd string) (BatchInfo, bool, error) {
+    info, err := scanBatch(q.QueryRow(batchSelect+` WHERE b.range_start = ? AND b.range_end = ? AND b.parent_id IS NULL
+        ORDER BY b.id DESC LIMIT 1`, rangeStart, rangeEnd))
+    if errors.Is(err, sql.ErrNoRows) {
+        return info, false, nil
+    }
+    if err != nil {
+        return info, false, err
+    }
+    return info, true, nil
+}
+
+// sameFile reports whether b was ingested from a file with the given
+// SHA-256 and report type. Batches from before report types were recorded
+// count as DefaultReportType.
+func sameFile(b BatchInfo, sum, reportType string) bool {
+    return b.SHA256 == sum && firstNonEmpty(b.ReportType, DefaultReportType) == reportType
+}
+
+// LatestBatch returns the most recent batch ingested for exactly the given
+// range, ignoring the chunk batches of larger ranges. ok is false when
+// there is none.
+func LatestBatch(dbPath, rangeStart, rangeEnd string) (info BatchInfo, ok bool, err error) {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return info, false, err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return info, false, err
+    }
+    return latestBatch(db, rangeStart, rangeEnd)
+}
+
+// EnsureSchema creates or migrates the ingest tables, for packages that
+// only read them.
+func EnsureSchema(dbPath string) error {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+    return initSchema(db)
+}
+
+// GetBatch returns a batch by ID. A parent batch reports the columns of
+// its chunks (see unionColumns).
+func GetBatch(dbPath string, id int64) (BatchInfo, error) {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return BatchInfo{}, err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return BatchInfo{}, err
+    }
+    return getBatchColumns(db, id)
+}
+
+// getBatchColumns is getBatch with the columns of a parent batch filled in
+// from its chunks.
+func getBatchColumns(db *sql.DB, id int64) (BatchInfo, error) {
+    info, err := getBatch(db, id)
+    if err != nil || len(info.Columns) > 0 {
+        return info, err
+    }
+    rows, err := db.Query(`SELECT meta_json FROM ingest_batches WHERE parent_id = ? ORDER BY id`, id)
+    if err != nil {
+        return info, err
+    }
+    defer rows.Close()
+    var chunks [][]string
+    for rows.Next() {
+        var meta sql.NullString
+        if err := rows.Scan(&meta); err != nil {
+            return info, err
+        }
+        var m batchMeta
+        if meta.Valid {
+            _ = json.Unmarshal([]byte(meta.String), &m)
+        }
+        chunks = append(chunks, m.Columns)
+    }
+    info.Columns = unionColumns(chunks)
+    return info, rows.Err()
+}
+
+// unionColumns merges the column lists of chunks: the columns of the first
+// chunk in order, then each column a later chunk adds, in the order it
+// first appears.
+func unionColumns(chunks [][]string) []string {
+    var out []string
+    seen := map[string]bool{}
+    for _, cols := range chunks {
+        for _, c := range cols {
+            if !seen[c] {
+                seen[c] = true
+                out = append(out, c)
+            }
+        }
+    }
+    return out
+}
+
+// BatchFilter narrows ListBatches results. Zero values mean no filter.
+type BatchFilter struct {
+    // From/To (YYYY-MM-DD) keep batches whose range overlaps [From, To].
+    From string
+    To   string
+    // Filename matches a substring of the file name.
+    Filename string
+    // CreatedFrom/CreatedTo bound created_at (YYYY-MM-DD or RFC 3339).
+    CreatedFrom string
+    CreatedTo   string
+    ReportType  string
+    // Current keeps only top-level batches no other batch supersedes.
+    Current bool
+    Limit   int
+    Offset  int
+}
+
+// ListBatches returns batches newest first, without their column lists.
+func ListBatches(dbPath string, f BatchFilter) ([]BatchInfo, error) {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return nil, err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return nil, err
+    }
+
+    var (
+        where []string
+        args  []any
+    )
+    if f.From != "" {
+        where = append(where, `b.range_end >= ?`)
+        args = append(args, f.From)
+    }
+    if f.To != "" {
+        where = append(where, `b.range_start <= ?`)
+        args = append(args, f.To)
+    }
+    if f.Filename != "" {
+        where = append(where, `instr(lower(b.filename), lower(?)) > 0`)
+        args = append(args, f.Filename)
+    }
+    if f.CreatedFrom != "" {
+        where = append(where, `b.created_at >= ?`)
+        args = append(args, f.CreatedFrom)
+    }
+    if f.CreatedTo != "" {
+        // a bare date includes the whole day
+        to := f.CreatedTo
+        if len(to) == len("2006-01-02") {
+            to += "T23:59:59Z"
+        }
+        where = append(where, `b.created_at <= ?`)
+        args = append(args, to)
+    }
+    if f.ReportType != "" {
+        where = append(where, `b.report_type = ?`)
+        args = append(args, f.ReportType)
+    }
+    if f.Current {
+        where = append(where, `b.parent_id IS NULL AND NOT EXISTS (SELECT 1 FROM ingest_batches n WHERE n.supersedes_id = b.id)`)
+    }
+    q := batchSelect
+    if len(where) > 0 {
+        q += ` WHERE ` + strings.Join(where, ` AND `)
+    }
+    limit := f.Limit
+    if limit <= 0 || limit > 500 {
+        limit = 50
+    }
+    q += ` ORDER BY b.id DESC LIMIT ? OFFSET ?`
+    args = append(args, limit, f.Offset)
+
+    rows, err := db.Query(q, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    out := []BatchInfo{}
+    for rows.Next() {
+        info, err := scanBatch(rows)
+        if err != nil {
+            return nil, err
+        }
+        info.Columns = nil
+        out = append(out, info)
+    }
+    return out, rows.Err()
+}
+
+// Row is one stored detail row. Data holds the original text of every
+// column and Values the parsed values of typed columns.
+type Row struct {
+    ID       int64             `json:"id"`
+    BatchID  int64             `json:"batchId"`
+    RowIndex int               `json:"rowIndex"`
+    Data     map[string]string `json:"data"`
+    Values   map[string]any    `json:"values,omitempty"`
+}
+
+// RowQuery selects rows of a batch. Rows are ordered by ID; After is the
+// cursor (the last ID already seen). Columns, when set, projects Data and
+// Values to those keys. Filters keep rows whose column equals the value;
+// the column must be one of the batch's ExportColumns.
+type RowQuery struct {
+    After   int64
+    Limit   int
+    Columns []string
+    Filters map[string]string
+}
+
+// RowPage is a page of rows. Next is the cursor for the following page,
+// zero when there are no more rows.
+type RowPage struct {
+    Rows []Row `json:"rows"`
+    Next int64 `json:"nextCursor,omitempty"`
+}
+
+// rowSelect selects the rows of a batch (the first two arguments, both the
+// batch ID) and of its chunks, for scanRow.
+const rowSelect = `SELECT id, batch_id, row_index, data_json, values_json FROM bateo_ventas_rows
+        WHERE (batch_id = ? OR batch_id IN (SELECT id FROM ingest_batches WHERE parent_id = ?))`
+
+func scanRow(sc scanner) (Row, error) {
+    var (
+        r          Row
+        dataJSON   string
+        valuesJSON sql.NullString
+    )
+    if err := sc.Scan(&r.ID, &r.BatchID, &r.RowIndex, &dataJSON, &valuesJSON); err != nil {
+        return r, err
+    }
+    _ = json.Unmarshal([]byte(dataJSON), &r.Data)
+    if valuesJSON.Valid {
+        _ = json.Unmarshal([]byte(valuesJSON.String), &r.Values)
+    }
+    return r, nil
+}
+
+// BatchRows returns a page of the rows of a batch, including the rows of
+// its chunks when it is a parent batch.
+func BatchRows(dbPath string, batchID int64, q RowQuery) (RowPage, error) {
+    page := RowPage{Rows: []Row{}}
+    db, err := openDB(dbPath)
+    if err != nil {
+        return page, err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return page, err
+    }
+    info, err := getBatchColumns(db, batchID)
+    if err != nil {
+        return page, err
+    }
+    keys := make([]string, 0, len(q.Filters))
+    for k := range q.Filters {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    if len(keys) > 0 {
+        cols, err := ExportColumns(info)
+        if err != nil {
+            return page, err
+        }
+        known := make(map[string]bool, len(cols))
+        for _, c := range cols {
+            known[c.Name] = true
+        }
+        for _, k := range keys {
+            if !known[k] {
+                return page, fmt.Errorf("%w: %q", ErrUnknownColumn, k)
+            }
+        }
+    }
+
+    sqlq := rowSelect + ` AND id > ?`
+    args := []any{batchID, batchID, q.After}
+    for _, k := range keys {
+        sqlq += ` AND json_extract(data_json, ?) = ?`
+        args = append(args, jsonPath(k), q.Filters[k])
+    }
+    limit := q.Limit
+    if limit <= 0 || limit > 1000 {
+        limit = 100
+    }
+    // one extra row tells whether there is a next page
+    sqlq += ` ORDER BY id LIMIT ?`
+    args = append(args, limit+1)
+
+    rows, err := db.Query(sqlq, args...)
+    if err != nil {
+        return page, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        if len(page.Rows) == limit {
+            page.Next = page.Rows[limit-1].ID
+            break
+        }
+        r, err := scanRow(rows)
+        if err != nil {
+            return page, err
+        }
+        if len(q.Columns) > 0 {
+            r.Data, r.Values = project(r.Data, r.Values, q.Columns)
+        }
+        page.Rows = append(page.Rows, r)
+    }
+    return page, rows.Err()
+}
+
+// jsonPath quotes a data key as a JSON path for json_extract.
+func jsonPath(key string) string {
+    return `$."` + strings.ReplaceAll(key, `"`, `\"`) + `"`
+}
+
+func project(data map[string]string, values map[string]any, cols []string) (map[string]string, map[string]any) {
+    d := make(map[string]string, len(cols))
+    var v map[string]any
+    for _, c := range cols {
+        if s, ok := data[c]; ok {
+            d[c] = s
+        }
+        if x, ok := values[c]; ok {
+            if v == nil {
+                v = map[string]any{}
+            }
+            v[c] = x
+        }
+    }
+    return d, v
+}
+
+// EachRow calls fn for every row of a batch (and of its chunks) in ID
+// order, streaming them from a single query.
+func EachRow(dbPath string, batchID int64, fn func(Row) error) error {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return err
+    }
+    if _, err := getBatch(db, batchID); err != nil {
+        return err
+    }
+    rows, err := db.Query(rowSelect+` ORDER BY id`, batchID, batchID)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        r, err := scanRow(rows)
+        if err != nil {
+            return err
+        }
+        if err := fn(r); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
+
+// Column is a column of a normalized export.
+type Column struct {
+    Name string
+    Type string // one of the Type* constants
+}
+
+// ExportColumns returns the columns of a normalized export of a batch:
+// every field of its report type's mapping, in mapping order, whether or
+// not the file had it, followed by the batch's unmapped columns.
+func ExportColumns(b BatchInfo) ([]Column, error) {
+    m, err := LoadMapping(b.ReportType)
+    if err != nil {
+        return nil, err
+    }
+    types := m.types()
+    var cols []Column
+    seen := map[string]bool{}
+    for _, f := range m.Fields {
+        typ := types[f.Name]
+        if typ == "" {
+            typ = TypeText
+        }
+        cols = append(cols, Column{Name: f.Name, Type: typ})
+        seen[f.Name] = true
+    }
+    for _, c := range b.Columns {
+        if !seen[c] {
+            cols = append(cols, Column{Name: c, Type: TypeText})
+            seen[c] = true
+        }
+    }
+    return cols, nil
+}
+
+// Value returns the normalized value of a column of r: a float64 for
+// numeric columns, a string otherwise (the parsed date for date columns).
+// It is nil when the row has no such column or a typed value did not
+// parse, so every export format sees the same value.
+func (c Column) Value(r Row) any {
+    switch {
+    case c.Numeric():
+        if f, ok := r.Values[c.Name].(float64); ok {
+            return f
+        }
+        return nil
+    case c.Type != TypeText:
+        if s, ok := r.Values[c.Name].(string); ok {
+            return s
+        }
+        return nil
+    }
+    if v, ok := r.Data[c.Name]; ok {
+        return v
+    }
+    return nil
+}
+
+// Numeric reports whether the column holds numbers.
+func (c Column) Numeric() bool {
+    return c.Type == TypeNumber || c.Type == TypeCurrency || c.Type == TypePercent
+}
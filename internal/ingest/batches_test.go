@@ -0,0 +1,88 @@
+package ingest
+
+import (
+    "errors"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestBatchRowsFilters(t *testing.T) {
+    dir := t.TempDir()
+    dbPath := filepath.Join(dir, "erp.sqlite")
+    f := writeFile(t, dir, "r.csv", "Sucursal,Importe,Nota\nS1,10,a\nS2,20,b\nS1,30,b\n")
+    b, err := IngestBateoExcel(dbPath, f, "2024-01-01", "2024-01-31")
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name     string
+        filters  map[string]string
+        wantRows int
+        wantErr  error
+    }{
+        {name: "no filter", wantRows: 3},
+        {name: "mapped column", filters: map[string]string{"sucursal": "S1"}, wantRows: 2},
+        {name: "unmapped column", filters: map[string]string{"nota": "b"}, wantRows: 2},
+        {name: "both", filters: map[string]string{"sucursal": "S1", "nota": "b"}, wantRows: 1},
+        {name: "mapping field the file lacks", filters: map[string]string{"vendedor": "Ana"}, wantRows: 0},
+        {name: "unknown column", filters: map[string]string{"sucursa": "S1"}, wantErr: ErrUnknownColumn},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            page, err := BatchRows(dbPath, b.ID, RowQuery{Filters: tt.filters})
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("err = %v, want %v", err, tt.wantErr)
+            }
+            if len(page.Rows) != tt.wantRows {
+                t.Fatalf("rows = %d, want %d", len(page.Rows), tt.wantRows)
+            }
+        })
+    }
+}
+
+// A parent batch has the columns of all its chunks.
+func TestParentColumns(t *testing.T) {
+    dir := t.TempDir()
+    dbPath := filepath.Join(dir, "erp.sqlite")
+    chunks := []Chunk{
+        {Path: writeFile(t, dir, "a.csv", "Sucursal,Importe,Nota\nS1,10,a\n"), RangeStart: "2024-01-01", RangeEnd: "2024-01-31"},
+        {Path: writeFile(t, dir, "b.csv", "Sucursal,Extra,Importe\nS1,x,5\n"), RangeStart: "2024-02-01", RangeEnd: "2024-02-29"},
+        {Path: writeFile(t, dir, "c.csv", "Otra,Sucursal\ny,S2\n"), RangeStart: "2024-03-01", RangeEnd: "2024-03-31"},
+    }
+    merged := writeFile(t, dir, "merged.csv", "Sucursal,Importe,Nota,Extra,Otra\n")
+    parent, _, err := IngestChunks(dbPath, "2024-01-01", "2024-03-31", merged, chunks)
+    if err != nil {
+        t.Fatal(err)
+    }
+    stored, err := GetBatch(dbPath, parent.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []string{"sucursal", "importe", "nota", "extra", "otra"}
+    tests := []struct {
+        name string
+        b    BatchInfo
+    }{
+        {name: "returned", b: parent},
+        {name: "stored", b: stored},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if !reflect.DeepEqual(tt.b.Columns, want) {
+                t.Fatalf("columns = %q, want %q", tt.b.Columns, want)
+            }
+            cols, err := ExportColumns(tt.b)
+            if err != nil {
+                t.Fatal(err)
+            }
+            var extra []string
+            for _, c := range cols[len(cols)-3:] {
+                extra = append(extra, c.Name)
+            }
+            if !reflect.DeepEqual(extra, []string{"nota", "extra", "otra"}) {
+                t.Fatalf("unmapped export columns = %q, want nota, extra, otra", extra)
+            }
+        })
+    }
+}
@@ -0,0 +1,65 @@
+package ingest
+
+import (
+    "strings"
+)
+
+// HeaderScanRows is how many leading rows are considered when looking for
+// the header row.
+var HeaderScanRows = 20
+
+// detectHeader picks the header row among the first HeaderScanRows rows.
+// Each row is scored by how many of its cells match a field of the mapping
+// and how many are non-numeric text; rows with fewer than two non-empty
+// cells (titles, printed dates) are never chosen. Ties go to the earliest
+// row. Without a candidate the first row is used.
+func detectHeader(rows [][]string, m *Mapping) int {
+    lookup := m.lookup()
+    best, bestScore := 0, 0
+    for i := 0; i < len(rows) && i < HeaderScanRows; i++ {
+        nonEmpty, text, known := 0, 0, 0
+        for _, c := range rows[i] {
+            c = strings.TrimSpace(c)
+            if c == "" {
+                continue
+            }
+            nonEmpty++
+            if _, ok := lookup[headerKey(c)]; ok {
+                known++
+            }
+            if _, ok := parseNumber(c); ok {
+                continue
+            }
+            if _, ok := parseDate(c); ok {
+                continue
+            }
+            text++
+        }
+        if nonEmpty < 2 {
+            continue
+        }
+        score := 3*known + text - (nonEmpty - text)
+        if score > bestScore {
+            best, bestScore = i, score
+        }
+    }
+    return best
+}
+
+// preamble returns the text of the non-empty rows above the header row
+// (report title, company, printed range), one string per row.
+func preamble(rows [][]string) []string {
+    var out []string
+    for _, r := range rows {
+        var parts []string
+        for _, c := range r {
+            if c = strings.TrimSpace(c); c != "" {
+                parts = append(parts, c)
+            }
+        }
+        if len(parts) > 0 {
+            out = append(out, strings.Join(parts, " "))
+        }
+    }
+    return out
+}
@@ -0,0 +1,228 @@
+package ingest
+
+import (
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestNormalizeHeader(t *testing.T) {
+    tests := []struct {
+        in   string
+        idx  int
+        want string
+    }{
+        {in: "Año (MXN)", want: "ano_mxn"},
+        {in: "  Nombre de Sucursal ", want: "nombre_de_sucursal"},
+        {in: "ÑANDÚ Über", want: "nandu_uber"},
+        {in: "% Bateo", want: "bateo"},
+        {in: "Importe__Total", want: "importe_total"},
+        {in: "2024 Ventas", want: "2024_ventas"},
+        {in: "Piezas/Unidades.", want: "piezas_unidades"},
+        {in: "---", idx: 2, want: "col_3"},
+        {in: "", want: "col_1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.in, func(t *testing.T) {
+            if got := normalizeHeader(tt.in, tt.idx); got != tt.want {
+                t.Fatalf("normalizeHeader(%q, %d) = %q, want %q", tt.in, tt.idx, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestUniqueKeys(t *testing.T) {
+    tests := []struct {
+        name         string
+        in   []string
+        want []string
+    }{
+        {name: "no repeats", in: []string{"a", "b"}, want: []string{"a", "b"}},
+        {name: "repeat", in: []string{"a", "b", "a"}, want: []string{"a", "b", "a_2"}},
+        {name: "three times", in: []string{"a", "a", "a"}, want: []string{"a", "a_2", "a_3"}},
+        {name: "suffix taken", in: []string{"a", "a_2", "a"}, want: []string{"a", "a_2", "a_3"}},
+        {name: "empty", in: []string{}, want: []string{}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := uniqueKeys(tt.in); !reflect.DeepEqual(got, tt.want) {
+                t.Fatalf("uniqueKeys(%q) = %q, want %q", tt.in, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestResolve(t *testing.T) {
+    m, err := LoadMapping(DefaultReportType)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name         string
+        headers      []string
+        wantKeys     []string
+        wantUnmapped []string
+        wantMissing  []string
+    }{
+        {
+            name:         "aliases and accents",
+            headers:      []string{"Tienda", "Artículo", "FECHA DE VENTA", "% Bateo"},
+            wantKeys:     []string{"sucursal", "producto", "fecha", "porcentaje_bateo"},
+        },
+        {
+            name:         "field matched once",
+            headers:      []string{"Sucursal", "Descripción", "Artículo", "Año (MXN)"},
+            wantKeys:     []string{"sucursal", "producto", "articulo", "ano_mxn"},
+            wantUnmapped: []string{"Artículo", "Año (MXN)"},
+        },
+        {
+            name:         "repeated unmapped header",
+            headers:      []string{"Sucursal", "Nota", "Nota"},
+            wantKeys:     []string{"sucursal", "nota", "nota_2"},
+            wantUnmapped: []string{"Nota", "Nota"},
+        },
+        {
+            name:         "missing required",
+            headers:      []string{"Producto", "Importe"},
+            wantKeys:     []string{"producto", "importe"},
+            wantMissing:  []string{"sucursal"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := m.resolve(tt.headers)
+            if !reflect.DeepEqual(got.Keys, tt.wantKeys) {
+                t.Errorf("keys = %q, want %q", got.Keys, tt.wantKeys)
+            }
+            if !reflect.DeepEqual(got.Unmapped, tt.wantUnmapped) {
+                t.Errorf("unmapped = %q, want %q", got.Unmapped, tt.wantUnmapped)
+            }
+            if !reflect.DeepEqual(got.MissingRequired, tt.wantMissing) {
+                t.Errorf("missing = %q, want %q", got.MissingRequired, tt.wantMissing)
+            }
+        })
+    }
+}
+
+func TestDetectHeader(t *testing.T) {
+    m, err := LoadMapping(DefaultReportType)
+    if err != nil {
+        t.Fatal(err)
+    }
+    banner := make([][]string, HeaderScanRows)
+    for i := range banner {
+        banner[i] = []string{"REPORTE BATEO"}
+    }
+    tests := []struct {
+        name string
+        rows [][]string
+        want int
+    }{
+        {
+            name: "first row",
+            rows: [][]string{{"Sucursal", "Importe"}, {"S1", "10.00"}},
+            want: 0,
+        },
+        {
+            name: "title banner",
+            rows: [][]string{
+                {"REPORTE BATEO"},
+                {"FARMACIAS DEL CENTRO SA DE CV", "", ""},
+                {"Del 01/10/2025 al 15/10/2025"},
+                {"Sucursal", "Folio", "Importe"},
+                {"S1", "T1", "10.00"},
+            },
+            want: 3,
+        },
+        {
+            name: "two-cell title row",
+            rows: [][]string{
+                {"Empresa:", "Farmacias del Centro"},
+                {"Zona", "Sucursal", "% Bateo"},
+                {"Norte", "S1", "20.94%"},
+            },
+            want: 1,
+        },
+        {
+            name: "numeric rows are not headers",
+            rows: [][]string{
+                {"2025", "10"},
+                {"Columna A", "Columna B"},
+                {"1", "2"},
+            },
+            want: 1,
+        },
+        {
+            name: "no candidate",
+            rows: [][]string{{"REPORTE BATEO"}, {"", "Del 01/10/2025"}},
+            want: 0,
+        },
+        {
+            name: "beyond the scanned rows",
+            rows: append(banner, []string{"Sucursal", "Importe"}),
+            want: 0,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := detectHeader(tt.rows, m); got != tt.want {
+                t.Fatalf("detectHeader = %d, want %d", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestPreamble(t *testing.T) {
+    tests := []struct {
+        name string
+        rows [][]string
+        want []string
+    }{
+        {name: "none", rows: nil, want: nil},
+        {
+            name: "joins cells and drops empty rows",
+            rows: [][]string{{"REPORTE BATEO", "", ""}, {"", ""}, {"", " Del 01/10/2025 ", "al 15/10/2025"}},
+            want: []string{"REPORTE BATEO", "Del 01/10/2025 al 15/10/2025"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := preamble(tt.rows); !reflect.DeepEqual(got, tt.want) {
+                t.Fatalf("preamble = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+// The header row and preamble are stored with the batch.
+func TestIngestBannerMeta(t *testing.T) {
+    dir := t.TempDir()
+    dbPath := filepath.Join(dir, "erp.sqlite")
+    f := writeFile(t, dir, "r.csv", "REPORTE BATEO,,\nDel 01/10/2025 al 15/10/2025,,\n,,\nSucursal,Folio,Importe\nS1,T1,10.00\n")
+    b, err := IngestBateoExcel(dbPath, f, "2025-10-01", "2025-10-15")
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err := GetBatch(dbPath, b.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name string
+        b    BatchInfo
+    }{
+        {name: "returned", b: b},
+        {name: "stored", b: got},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if tt.b.HeaderRow != 3 || tt.b.Rows != 1 {
+                t.Errorf("headerRow = %d, rows = %d, want 3 and 1", tt.b.HeaderRow, tt.b.Rows)
+            }
+            want := []string{"REPORTE BATEO", "Del 01/10/2025 al 15/10/2025"}
+            if !reflect.DeepEqual(tt.b.Preamble, want) {
+                t.Errorf("preamble = %q, want %q", tt.b.Preamble, want)
+            }
+        })
+    }
+}
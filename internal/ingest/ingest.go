@@ -1,10 +1,10 @@
 package ingest
 
 import (
+    "crypto/sha256"
     "database/sql"
-    "encoding/csv"
+    "encoding/hex"
     "encoding/json"
-    "errors"
     "fmt"
     "io"
     "os"
@@ -12,8 +12,6 @@ import (
     "strings"
     "time"
     _ "modernc.org/sqlite"
-    "github.com/xuri/excelize/v2"
-    xls "github.com/extrame/xls"
 )
 
 type BatchInfo struct {
@@ -22,6 +20,56 @@ type BatchInfo struct {
     RangeEnd   string `json:"rangeEnd"`
     Filename   string `json:"filename"`
     Rows       int    `json:"rows"`
+    // TotalRows counts the subtotal/total rows moved to batch_totals.
+    TotalRows  int    `json:"totalRows,omitempty"`
+    CreatedAt  string `json:"createdAt,omitempty"`
+    ParentID   int64  `json:"parentId,omitempty"`
+    ReportType string `json:"reportType,omitempty"`
+    // Unmapped lists source headers that matched no field of the report
+    // type's mapping; they are stored under their normalized name.
+    Unmapped []string `json:"unmappedColumns,omitempty"`
+    // MissingRequired lists required fields no header matched.
+    MissingRequired []string `json:"missingRequired,omitempty"`
+    // HeaderRow is the 0-based sheet row used as the header; Preamble holds
+    // the text of the rows above it.
+    HeaderRow int      `json:"headerRow"`
+    Preamble  []string `json:"preamble,omitempty"`
+    // Locale is the locale typed columns were parsed with.
+    Locale string `json:"locale,omitempty"`
+    // SHA256 and Size identify the ingested file's content.
+    SHA256 string `json:"sha256,omitempty"`
+    Size   int64  `json:"size,omitempty"`
+    // Supersedes is the batch for the same range this one replaced.
+    Supersedes int64 `json:"supersedes,omitempty"`
+    // Duplicate is set when the file was the one of the latest batch of
+    // its range and that batch was returned instead of a new one.
+    Duplicate bool `json:"duplicate,omitempty"`
+    // Columns are the data keys of the batch's rows, in sheet order.
+    Columns []string `json:"columns,omitempty"`
+}
+
+// batchMeta is the part of BatchInfo stored in ingest_batches.meta_json.
+type batchMeta struct {
+    Unmapped        []string `json:"unmappedColumns,omitempty"`
+    MissingRequired []string `json:"missingRequired,omitempty"`
+    HeaderRow       int      `json:"headerRow"`
+    Preamble        []string `json:"preamble,omitempty"`
+    Locale          string   `json:"locale,omitempty"`
+    Columns         []string `json:"columns,omitempty"`
+}
+
+// Options controls how an export file is ingested.
+type Options struct {
+    RangeStart string
+    RangeEnd   string
+    // ParentID links the batch to a parent batch (e.g. one chunk of a
+    // larger range). Zero means no parent.
+    ParentID int64
+    // ReportType selects the header mapping (see LoadMapping); empty means
+    // DefaultReportType.
+    ReportType string
+    // Locale overrides the mapping's locale for parsing typed columns.
+    Locale string
 }
 
 func ensureDir(path string) error {
@@ -32,7 +80,9 @@ func openDB(dbPath string) (*sql.DB, error) {
     if err := ensureDir(filepath.Dir(dbPath)); err != nil {
         return nil, err
     }
-    return sql.Open("sqlite", dbPath)
+    // immediate transactions take the write lock up front, so the
+    // duplicate check and the insert of concurrent ingests do not interleave
+    return sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_txlock=immediate")
 }
 
 func initSchema(db *sql.DB) error {
@@ -58,34 +108,202 @@ func initSchema(db *sql.DB) error {
             return err
         }
     }
-    return nil
+    // columns added after the initial schema
+    if err := ensureColumn(db, "ingest_batches", "parent_id", "INTEGER REFERENCES ingest_batches(id)"); err != nil {
+        return err
+    }
+    if err := ensureColumn(db, "ingest_batches", "report_type", "TEXT"); err != nil {
+        return err
+    }
+    if err := ensureColumn(db, "ingest_batches", "meta_json", "TEXT"); err != nil {
+        return err
+    }
+    if err := ensureColumn(db, "bateo_ventas_rows", "values_json", "TEXT"); err != nil {
+        return err
+    }
+    for _, c := range [][2]string{
+        {"sha256", "TEXT"},
+        {"size", "INTEGER"},
+        {"supersedes_id", "INTEGER REFERENCES ingest_batches(id)"},
+    } {
+        if err := ensureColumn(db, "ingest_batches", c[0], c[1]); err != nil {
+            return err
+        }
+    }
+    if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_ingest_batches_sha ON ingest_batches(sha256);`); err != nil {
+        return err
+    }
+    if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_ingest_batches_range ON ingest_batches(range_start, range_end);`); err != nil {
+        return err
+    }
+    if err := initTotalsSchema(db); err != nil {
+        return err
+    }
+    return initVentasSchema(db)
 }
 
-// IngestBateoExcel ingests an export file (.xlsx or .csv) into SQLite as JSON rows
+// ensureColumn adds a column to an existing table if it is missing.
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+    found, err := hasColumn(db, table, column)
+    if err != nil || found {
+        return err
+    }
+    _, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl)
+    return err
+}
+
+// hasColumn reports whether a table has a column.
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+    rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+    if err != nil {
+        return false, err
+    }
+    found := false
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            rows.Close()
+            return false, err
+        }
+        if name == column {
+            found = true
+        }
+    }
+    if err := rows.Err(); err != nil {
+        rows.Close()
+        return false, err
+    }
+    rows.Close()
+    return found, nil
+}
+
+// IngestBateoExcel ingests an export file (.xlsx, .xls or .csv) into SQLite as JSON rows
 // grouped by an ingest batch keyed by the date range.
 func IngestBateoExcel(dbPath, exportPath, rangeStart, rangeEnd string) (BatchInfo, error) {
-    var info BatchInfo
+    return Ingest(dbPath, exportPath, Options{RangeStart: rangeStart, RangeEnd: rangeEnd})
+}
+
+// Ingest is IngestBateoExcel with the full set of options.
+//
+// A file with the same content and report type as the latest batch of its
+// range is not ingested again: that batch is returned with Duplicate set.
+// Otherwise the new batch supersedes the latest batch of its range. The
+// check and the insert run in one transaction. Chunk batches (ParentID
+// set) are always ingested and never supersede anything; their parent does.
+func Ingest(dbPath, exportPath string, opts Options) (BatchInfo, error) {
+    f, err := readExport(exportPath, opts)
+    if err != nil {
+        return BatchInfo{}, err
+    }
 
     db, err := openDB(dbPath)
     if err != nil {
-        return info, err
+        return BatchInfo{}, err
     }
     defer db.Close()
 
     if err := initSchema(db); err != nil {
-        return info, err
+        return BatchInfo{}, err
     }
 
     tx, err := db.Begin()
     if err != nil {
-        return info, err
+        return BatchInfo{}, err
     }
     defer func() {
         _ = tx.Rollback()
     }()
+    var supersedes any
+    if opts.ParentID == 0 {
+        prev, ok, err := latestBatch(tx, opts.RangeStart, opts.RangeEnd)
+        if err != nil {
+            return BatchInfo{}, err
+        }
+        if ok && sameFile(prev, f.sum, f.mapping.ReportType) {
+            prev.Duplicate = true
+            return prev, nil
+        }
+        if ok {
+            supersedes = prev.ID
+        }
+    }
+    info, err := insertBatch(tx, f, opts, supersedes, time.Now().UTC().Format(time.RFC3339))
+    if err != nil {
+        return BatchInfo{}, err
+    }
+    if err := tx.Commit(); err != nil {
+        return BatchInfo{}, err
+    }
+    return info, nil
+}
 
-    now := time.Now().UTC().Format(time.RFC3339)
-    res, err := tx.Exec(`INSERT INTO ingest_batches(range_start, range_end, filename, created_at) VALUES(?,?,?,?)`, rangeStart, rangeEnd, filepath.Base(exportPath), now)
+// exportFile is an export file read and matched against the mapping of its
+// report type, ready for insertBatch.
+type exportFile struct {
+    name      string
+    sum       string
+    size      int64
+    mapping   *Mapping
+    loc       Locale
+    sh        sheet
+    headerRow int
+    pre       []string
+    cols      columnsResult
+}
+
+func readExport(exportPath string, opts Options) (*exportFile, error) {
+    mapping, err := LoadMapping(opts.ReportType)
+    if err != nil {
+        return nil, err
+    }
+    sum, size, err := hashFile(exportPath)
+    if err != nil {
+        return nil, err
+    }
+    loc, err := LookupLocale(firstNonEmpty(opts.Locale, mapping.Locale))
+    if err != nil {
+        return nil, err
+    }
+    sh, err := readSheet(exportPath)
+    if err != nil {
+        return nil, err
+    }
+    f := &exportFile{name: filepath.Base(exportPath), sum: sum, size: size, mapping: mapping, loc: loc, sh: sh}
+    // Header row -> headers; rows above it are the report's preamble
+    if len(sh.Rows) > 0 {
+        f.headerRow = detectHeader(sh.Rows, mapping)
+        f.pre = preamble(sh.Rows[:f.headerRow])
+        f.cols = mapping.resolve(sh.Rows[f.headerRow])
+    }
+    return f, nil
+}
+
+// insertBatch inserts the batch row of f and its data rows.
+func insertBatch(tx *sql.Tx, f *exportFile, opts Options, supersedes any, now string) (BatchInfo, error) {
+    var info BatchInfo
+    mapping, loc, sh := f.mapping, f.loc, f.sh
+    var rows [][]string
+    if len(sh.Rows) > 0 {
+        rows = sh.Rows[f.headerRow+1:]
+    }
+    headers := f.cols.Keys
+    types := mapping.types()
+    meta, _ := json.Marshal(batchMeta{
+        Unmapped:        f.cols.Unmapped,
+        MissingRequired: f.cols.MissingRequired,
+        HeaderRow:       f.headerRow,
+        Preamble:        f.pre,
+        Locale:          loc.Name,
+        Columns:         headers,
+    })
+
+    var parent any
+    if opts.ParentID != 0 {
+        parent = opts.ParentID
+    }
+    res, err := tx.Exec(`INSERT INTO ingest_batches(range_start, range_end, filename, created_at, parent_id, report_type, meta_json, sha256, size, supersedes_id)
+        VALUES(?,?,?,?,?,?,?,?,?,?)`,
+        opts.RangeStart, opts.RangeEnd, f.name, now, parent, mapping.ReportType, string(meta), f.sum, f.size, supersedes)
     if err != nil {
         return info, err
     }
@@ -94,173 +312,267 @@ func IngestBateoExcel(dbPath, exportPath, rangeStart, rangeEnd string) (BatchInf
         return info, err
     }
 
-    // Detect extension and route parser
-    ext := strings.ToLower(filepath.Ext(exportPath))
-    var headers []string
     rowIndex := 0
+    stored, totals := 0, 0
 
-    insertRow := func(idx int, data map[string]string) error {
-        b, _ := json.Marshal(data)
-        _, err := tx.Exec(`INSERT INTO bateo_ventas_rows(batch_id, row_index, data_json) VALUES(?,?,?)`, batchID, idx, string(b))
-        return err
+    // only the bateo report is copied to the typed bateo_ventas table;
+    // other report types keep their rows in data_json/values_json
+    var typed map[string]string
+    if mapping.ReportType == DefaultReportType {
+        typed = ventasMapping(headers)
     }
-
-    switch ext {
-    case ".xlsx":
-        f, err := excelize.OpenFile(exportPath)
-        if err != nil {
-            return info, err
-        }
-        defer func() { _ = f.Close() }()
-        sheets := f.GetSheetList()
-        if len(sheets) == 0 {
-            return info, errors.New("xlsx has no sheets")
+    insertRow := func(idx int, data map[string]string, values map[string]any) error {
+        b, _ := json.Marshal(data)
+        var vj any
+        if len(values) > 0 {
+            v, _ := json.Marshal(values)
+            vj = string(v)
         }
-        sheet := sheets[0]
-        rows, err := f.GetRows(sheet)
+        res, err := tx.Exec(`INSERT INTO bateo_ventas_rows(batch_id, row_index, data_json, values_json) VALUES(?,?,?,?)`, batchID, idx, string(b), vj)
         if err != nil {
-            return info, err
+            return err
         }
-        for _, r := range rows {
-            if headers == nil {
-                headers = make([]string, len(r))
-                for i, h := range r {
-                    headers[i] = normalizeHeader(h, i)
-                }
-                continue
-            }
-            // Build row map
-            rowIndex++
-            data := make(map[string]string, len(headers))
-            for i, h := range headers {
-                var v string
-                if i < len(r) {
-                    v = strings.TrimSpace(r[i])
-                }
-                data[h] = v
-            }
-            // skip empty rows
-            if rowIsEmpty(data) {
-                continue
-            }
-            if err := insertRow(rowIndex, data); err != nil {
-                return info, err
-            }
+        // typed copy for SQL aggregations; data_json keeps every column
+        if len(typed) == 0 {
+            return nil
         }
-
-    case ".xls":
-        wb, err := xls.Open(exportPath, "utf-8")
+        rowID, err := res.LastInsertId()
         if err != nil {
-            return info, err
-        }
-        if wb.NumSheets() == 0 {
-            return info, errors.New("xls has no sheets")
+            return err
         }
-        sh := wb.GetSheet(0)
-        if sh == nil {
-            return info, errors.New("failed to open first xls sheet")
+        return insertVentasRow(tx, batchID, rowID, idx, typed, data, values)
+    }
+
+    for n, r := range rows {
+        rowIndex++
+        data := rowData(headers, r)
+        // skip empty rows
+        if rowIsEmpty(data) {
+            continue
         }
-        // Iterate rows: first row -> headers
-        for r := 0; r <= int(sh.MaxRow); r++ {
-            row := sh.Row(r)
-            if row == nil {
-                continue
-            }
-            cols := row.LastCol()
-            if headers == nil {
-                headers = make([]string, cols)
-                for i := 0; i < cols; i++ {
-                    headers[i] = normalizeHeader(row.Col(i), i)
-                }
-                continue
-            }
-            rowIndex++
-            data := make(map[string]string, len(headers))
-            for i, h := range headers {
-                var v string
-                if i < cols {
-                    v = strings.TrimSpace(row.Col(i))
-                }
-                data[h] = v
+        // the report's own subtotals/totals are kept apart from the data
+        if kind, label := mapping.classify(headers, data); kind != RowDetail {
+            if err := insertTotalRow(tx, batchID, rowIndex, kind, label, data); err != nil {
+                return info, err
             }
-            if rowIsEmpty(data) {
+            totals++
+            continue
+        }
+        // canonical values of typed columns (see sheet.parse)
+        values := map[string]any{}
+        for i, h := range headers {
+            typ := types[h]
+            if typ == "" || typ == TypeText || data[h] == "" {
                 continue
             }
-            if err := insertRow(rowIndex, data); err != nil {
-                return info, err
+            if v, ok := sh.parse(loc, typ, f.headerRow+1+n, i, data[h]); ok {
+                values[h] = v
             }
         }
-
-    case ".csv":
-        fi, err := os.Open(exportPath)
-        if err != nil {
+        if err := insertRow(rowIndex, data, values); err != nil {
             return info, err
         }
-        defer fi.Close()
-        r := csv.NewReader(fi)
-        r.FieldsPerRecord = -1
-        for {
-            rec, err := r.Read()
-            if err == io.EOF {
-                break
-            }
-            if err != nil {
-                return info, err
-            }
-            if headers == nil {
-                headers = make([]string, len(rec))
-                for i, h := range rec {
-                    headers[i] = normalizeHeader(h, i)
-                }
-                continue
-            }
-            rowIndex++
-            data := make(map[string]string, len(headers))
-            for i, h := range headers {
-                var v string
-                if i < len(rec) {
-                    v = strings.TrimSpace(rec[i])
-                }
-                data[h] = v
-            }
-            if rowIsEmpty(data) {
-                continue
-            }
-            if err := insertRow(rowIndex, data); err != nil {
-                return info, err
-            }
+        stored++
+    }
+
+    info = BatchInfo{
+        ID:              batchID,
+        RangeStart:      opts.RangeStart,
+        RangeEnd:        opts.RangeEnd,
+        Filename:        f.name,
+        Rows:            stored,
+        TotalRows:       totals,
+        CreatedAt:       now,
+        ParentID:        opts.ParentID,
+        ReportType:      mapping.ReportType,
+        Unmapped:        f.cols.Unmapped,
+        MissingRequired: f.cols.MissingRequired,
+        HeaderRow:       f.headerRow,
+        Preamble:        f.pre,
+        Locale:          loc.Name,
+        SHA256:          f.sum,
+        Size:            f.size,
+        Columns:         headers,
+    }
+    if id, ok := supersedes.(int64); ok {
+        info.Supersedes = id
+    }
+    return info, nil
+}
+
+// Chunk is one file of a range exported in several parts.
+type Chunk struct {
+    Path       string
+    RangeStart string
+    RangeEnd   string
+}
+
+// IngestChunks ingests the chunks of rangeStart..rangeEnd as children of a
+// parent batch that holds no rows of its own; merged is the merged file
+// covering the whole range. The parent and every chunk are written in one
+// transaction: if any chunk fails nothing is ingested and the previous
+// batch of the range stays current. As with Ingest, when the merged file is
+// the one of the latest batch of the range, that batch is returned with
+// Duplicate set.
+func IngestChunks(dbPath, rangeStart, rangeEnd, merged string, chunks []Chunk) (BatchInfo, []BatchInfo, error) {
+    var info BatchInfo
+    sum, size, err := hashFile(merged)
+    if err != nil {
+        return info, nil, err
+    }
+    files := make([]*exportFile, len(chunks))
+    for i, c := range chunks {
+        if files[i], err = readExport(c.Path, Options{}); err != nil {
+            return info, nil, fmt.Errorf("chunk %s..%s: %w", c.RangeStart, c.RangeEnd, err)
         }
-    default:
-        return info, fmt.Errorf("unsupported export extension: %s", ext)
     }
 
-    if err := tx.Commit(); err != nil {
-        return info, err
+    db, err := openDB(dbPath)
+    if err != nil {
+        return info, nil, err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return info, nil, err
     }
 
-    info = BatchInfo{
-        ID:         batchID,
-        RangeStart: rangeStart,
-        RangeEnd:   rangeEnd,
-        Filename:   filepath.Base(exportPath),
-        Rows:       rowIndex,
+    tx, err := db.Begin()
+    if err != nil {
+        return info, nil, err
     }
-    return info, nil
+    defer func() {
+        _ = tx.Rollback()
+    }()
+    var supersedes any
+    prev, ok, err := latestBatch(tx, rangeStart, rangeEnd)
+    if err != nil {
+        return info, nil, err
+    }
+    if ok && sameFile(prev, sum, DefaultReportType) {
+        prev.Duplicate = true
+        return prev, nil, nil
+    }
+    if ok {
+        supersedes = prev.ID
+        info.Supersedes = prev.ID
+    }
+    now := time.Now().UTC().Format(time.RFC3339)
+    res, err := tx.Exec(`INSERT INTO ingest_batches(range_start, range_end, filename, created_at, report_type, sha256, size, supersedes_id) VALUES(?,?,?,?,?,?,?,?)`,
+        rangeStart, rangeEnd, filepath.Base(merged), now, DefaultReportType, sum, size, supersedes)
+    if err != nil {
+        return info, nil, err
+    }
+    id, err := res.LastInsertId()
+    if err != nil {
+        return info, nil, err
+    }
+    children := make([]BatchInfo, len(chunks))
+    cols := make([][]string, len(chunks))
+    for i, c := range chunks {
+        opts := Options{RangeStart: c.RangeStart, RangeEnd: c.RangeEnd, ParentID: id}
+        if children[i], err = insertBatch(tx, files[i], opts, nil, now); err != nil {
+            return BatchInfo{}, nil, fmt.Errorf("chunk %s..%s: %w", c.RangeStart, c.RangeEnd, err)
+        }
+        info.Rows += children[i].Rows
+        cols[i] = children[i].Columns
+    }
+    info.Columns = unionColumns(cols)
+    if err := tx.Commit(); err != nil {
+        return BatchInfo{}, nil, err
+    }
+
+    info.ID = id
+    info.RangeStart, info.RangeEnd = rangeStart, rangeEnd
+    info.Filename = filepath.Base(merged)
+    info.CreatedAt = now
+    info.ReportType = DefaultReportType
+    info.SHA256, info.Size = sum, size
+    return info, children, nil
 }
 
+// normalizeHeader turns a source header into a data key: lower case,
+// accents folded (á→a, ñ→n), and every run of other characters replaced by
+// a single underscore. Headers with nothing left become col_<n>.
 func normalizeHeader(h string, idx int) string {
-    h = strings.TrimSpace(h)
-    if h == "" {
+    h = foldAccents(strings.ToLower(strings.TrimSpace(h)))
+    var b strings.Builder
+    for _, r := range h {
+        if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+            b.WriteRune(r)
+            continue
+        }
+        if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+            b.WriteByte('_')
+        }
+    }
+    out := strings.TrimSuffix(b.String(), "_")
+    if out == "" {
         return fmt.Sprintf("col_%d", idx+1)
     }
-    // Replace spaces and special chars with underscores; lower-case
-    h = strings.ToLower(h)
-    repl := func(r rune) rune {
-        if r >= 'a' && r <= 'z' { return r }
-        if r >= '0' && r <= '9' { return r }
-        return '_'
+    return out
+}
+
+// uniqueKeys suffixes repeated keys with _2, _3, ... so no column
+// overwrites another in the row map.
+func uniqueKeys(keys []string) []string {
+    seen := make(map[string]bool, len(keys))
+    for _, k := range keys {
+        seen[k] = true
+    }
+    count := map[string]int{}
+    out := make([]string, len(keys))
+    for i, k := range keys {
+        count[k]++
+        if count[k] == 1 {
+            out[i] = k
+            continue
+        }
+        n := count[k]
+        for seen[fmt.Sprintf("%s_%d", k, n)] {
+            n++
+        }
+        out[i] = fmt.Sprintf("%s_%d", k, n)
+        seen[out[i]] = true
+        count[k] = n
+    }
+    return out
+}
+
+// hashFile returns the hex SHA-256 and size of a file.
+func hashFile(path string) (string, int64, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return "", 0, err
+    }
+    defer f.Close()
+    h := sha256.New()
+    n, err := io.Copy(h, f)
+    if err != nil {
+        return "", 0, err
+    }
+    return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func firstNonEmpty(vals ...string) string {
+    for _, v := range vals {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
+
+// rowData maps the cells of a sheet row to the data keys of its columns.
+func rowData(keys, r []string) map[string]string {
+    data := make(map[string]string, len(keys))
+    for i, k := range keys {
+        var v string
+        if i < len(r) {
+            v = strings.TrimSpace(r[i])
+        }
+        data[k] = v
     }
-    return strings.Map(repl, h)
+    return data
 }
 
 func rowIsEmpty(m map[string]string) bool {
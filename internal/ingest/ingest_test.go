@@ -0,0 +1,183 @@
+package ingest
+
+import (
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+)
+
+// writeFile writes body to dir/name and returns its path.
+func writeFile(t *testing.T, dir, name, body string) string {
+    t.Helper()
+    p := filepath.Join(dir, name)
+    if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return p
+}
+
+func TestIngestChunks(t *testing.T) {
+    tests := []struct {
+        name     string
+        second   string // name of the second chunk file
+        wantErr  bool
+        wantRows int
+    }{
+        {name: "all chunks ingest", second: "b.csv", wantRows: 3},
+        {name: "failed chunk keeps previous batch", second: "b.txt", wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            db := filepath.Join(dir, "erp.sqlite")
+            prev, err := IngestBateoExcel(db, writeFile(t, dir, "prev.csv", "Sucursal,Importe\nS1,1\n"), "2024-01-01", "2024-02-29")
+            if err != nil {
+                t.Fatal(err)
+            }
+            chunks := []Chunk{
+                {Path: writeFile(t, dir, "a.csv", "Sucursal,Importe\nS1,10\nS2,20\n"), RangeStart: "2024-01-01", RangeEnd: "2024-01-31"},
+                {Path: writeFile(t, dir, tt.second, "Sucursal,Importe\nS1,5\n"), RangeStart: "2024-02-01", RangeEnd: "2024-02-29"},
+            }
+            merged := writeFile(t, dir, "merged.csv", "Sucursal,Importe\nS1,10\nS2,20\nS1,5\n")
+            parent, children, err := IngestChunks(db, "2024-01-01", "2024-02-29", merged, chunks)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("IngestChunks error = %v, wantErr %v", err, tt.wantErr)
+            }
+            latest, ok, err := LatestBatch(db, "2024-01-01", "2024-02-29")
+            if err != nil || !ok {
+                t.Fatalf("LatestBatch = %v, %v", ok, err)
+            }
+            if tt.wantErr {
+                if latest.ID != prev.ID {
+                    t.Fatalf("latest batch = %d, want previous %d", latest.ID, prev.ID)
+                }
+                return
+            }
+            if latest.ID != parent.ID || parent.Supersedes != prev.ID {
+                t.Fatalf("latest = %d, parent = %+v, want parent superseding %d", latest.ID, parent, prev.ID)
+            }
+            if len(children) != 2 || latest.Rows != tt.wantRows || parent.Rows != tt.wantRows {
+                t.Fatalf("children = %d, rows = %d/%d, want 2 chunks and %d rows", len(children), latest.Rows, parent.Rows, tt.wantRows)
+            }
+        })
+    }
+}
+
+func TestIngestTypedRowsByReportType(t *testing.T) {
+    mappings := t.TempDir()
+    writeFile(t, mappings, "inventario.json", `{"fields": [{"name": "sucursal", "required": true}, {"name": "importe", "type": "currency"}]}`)
+    old := MappingsDir
+    MappingsDir = mappings
+    defer func() { MappingsDir = old }()
+
+    tests := []struct {
+        name       string
+        reportType string
+        wantTyped  int
+    }{
+        {name: "bateo report", reportType: DefaultReportType, wantTyped: 2},
+        {name: "other report", reportType: "inventario", wantTyped: 0},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            dbPath := filepath.Join(dir, "erp.sqlite")
+            f := writeFile(t, dir, "r.csv", "Sucursal,Importe\nS1,10\nS2,20\n")
+            b, err := Ingest(dbPath, f, Options{RangeStart: "2024-01-01", RangeEnd: "2024-01-31", ReportType: tt.reportType})
+            if err != nil {
+                t.Fatal(err)
+            }
+            if b.Rows != 2 {
+                t.Fatalf("rows = %d, want 2", b.Rows)
+            }
+            db, err := openDB(dbPath)
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer db.Close()
+            var n int
+            if err := db.QueryRow(`SELECT COUNT(*) FROM bateo_ventas WHERE batch_id = ?`, b.ID).Scan(&n); err != nil {
+                t.Fatal(err)
+            }
+            if n != tt.wantTyped {
+                t.Fatalf("typed rows = %d, want %d", n, tt.wantTyped)
+            }
+        })
+    }
+}
+
+// Each step ingests file A or B for a range; a duplicate returns the
+// latest batch of that range, anything else supersedes it.
+func TestIngestDuplicates(t *testing.T) {
+    dir := t.TempDir()
+    dbPath := filepath.Join(dir, "erp.sqlite")
+    files := map[string]string{
+        "A": writeFile(t, dir, "a.csv", "Sucursal,Importe\nS1,10\n"),
+        "B": writeFile(t, dir, "b.csv", "Sucursal,Importe\nS1,20\n"),
+    }
+    tests := []struct {
+        name           string
+        file           string
+        rangeStart     string
+        wantDuplicate  bool
+        wantID         int64
+        wantSupersedes int64
+    }{
+        {name: "first", file: "A", rangeStart: "2024-01-01", wantID: 1},
+        {name: "same file, same range", file: "A", rangeStart: "2024-01-01", wantDuplicate: true, wantID: 1},
+        {name: "same file, other range", file: "A", rangeStart: "2024-01-02", wantID: 2},
+        {name: "new content", file: "B", rangeStart: "2024-01-01", wantID: 3, wantSupersedes: 1},
+        {name: "back to the first file", file: "A", rangeStart: "2024-01-01", wantID: 4, wantSupersedes: 3},
+        {name: "repeat", file: "A", rangeStart: "2024-01-01", wantDuplicate: true, wantID: 4, wantSupersedes: 3},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            b, err := IngestBateoExcel(dbPath, files[tt.file], tt.rangeStart, "2024-01-31")
+            if err != nil {
+                t.Fatal(err)
+            }
+            if b.Duplicate != tt.wantDuplicate || b.ID != tt.wantID || b.Supersedes != tt.wantSupersedes {
+                t.Fatalf("batch = {id %d, duplicate %v, supersedes %d}, want {id %d, duplicate %v, supersedes %d}",
+                    b.ID, b.Duplicate, b.Supersedes, tt.wantID, tt.wantDuplicate, tt.wantSupersedes)
+            }
+        })
+    }
+}
+
+// Concurrent ingests of the same file leave a single batch.
+func TestIngestConcurrentDuplicates(t *testing.T) {
+    dir := t.TempDir()
+    dbPath := filepath.Join(dir, "erp.sqlite")
+    f := writeFile(t, dir, "a.csv", "Sucursal,Importe\nS1,10\n")
+    if err := EnsureSchema(dbPath); err != nil {
+        t.Fatal(err)
+    }
+    const n = 8
+    var wg sync.WaitGroup
+    results := make([]BatchInfo, n)
+    errs := make([]error, n)
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            results[i], errs[i] = IngestBateoExcel(dbPath, f, "2024-01-01", "2024-01-31")
+        }(i)
+    }
+    wg.Wait()
+    created := 0
+    for i := range results {
+        if errs[i] != nil {
+            t.Fatalf("ingest %d: %v", i, errs[i])
+        }
+        if !results[i].Duplicate {
+            created++
+        }
+        if results[i].ID != results[0].ID {
+            t.Fatalf("ingest %d returned batch %d, want %d", i, results[i].ID, results[0].ID)
+        }
+    }
+    if created != 1 {
+        t.Fatalf("%d ingests created a batch, want 1", created)
+    }
+}
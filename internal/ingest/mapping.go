@@ -0,0 +1,203 @@
+package ingest
+
+import (
+    "embed"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "unicode"
+)
+
+// DefaultReportType is used when Options.ReportType is empty.
+const DefaultReportType = "bateo_ventas"
+
+// MappingsDir, when set, is searched for <reportType>.json before the
+// mappings built into the binary.
+var MappingsDir string
+
+//go:embed mappings/*.json
+var builtinMappings embed.FS
+
+// ErrUnknownReportType is returned when no mapping exists for a report type.
+var ErrUnknownReportType = errors.New("unknown report type")
+
+// Mapping maps the headers of one report type to canonical field names.
+type Mapping struct {
+    ReportType string  `json:"reportType"`
+    Fields     []Field `json:"fields"`
+    // RowRules classify rows that are not detail rows (see classify).
+    RowRules []RowRule `json:"rowRules,omitempty"`
+    // Locale is how the report writes numbers and dates (see Locales).
+    Locale string `json:"locale,omitempty"`
+}
+
+// Field is a canonical column. A header matches it when, after folding
+// case, accents and punctuation, it equals the name or one of the aliases.
+type Field struct {
+    Name     string   `json:"name"`
+    Aliases  []string `json:"aliases,omitempty"`
+    Required bool     `json:"required,omitempty"`
+    // Type is one of the Type* constants; empty means text.
+    Type string `json:"type,omitempty"`
+}
+
+// LoadMapping reads the mapping for reportType from MappingsDir or, failing
+// that, from the built-in mappings.
+func LoadMapping(reportType string) (*Mapping, error) {
+    if reportType == "" {
+        reportType = DefaultReportType
+    }
+    if strings.ContainsAny(reportType, `/\.`) {
+        return nil, fmt.Errorf("%w: %q", ErrUnknownReportType, reportType)
+    }
+    name := reportType + ".json"
+    var (
+        b   []byte
+        err error
+    )
+    if MappingsDir != "" {
+        b, err = os.ReadFile(filepath.Join(MappingsDir, name))
+    }
+    if MappingsDir == "" || errors.Is(err, os.ErrNotExist) {
+        b, err = builtinMappings.ReadFile("mappings/" + name)
+        if errors.Is(err, os.ErrNotExist) {
+            return nil, fmt.Errorf("%w: %q", ErrUnknownReportType, reportType)
+        }
+    }
+    if err != nil {
+        return nil, err
+    }
+    var m Mapping
+    if err := json.Unmarshal(b, &m); err != nil {
+        return nil, fmt.Errorf("mapping %s: %w", name, err)
+    }
+    if m.ReportType == "" {
+        m.ReportType = reportType
+    }
+    for _, f := range m.Fields {
+        switch f.Type {
+        case "", TypeText, TypeNumber, TypeCurrency, TypePercent, TypeDate:
+        default:
+            return nil, fmt.Errorf("mapping %s: field %s: unknown type %q", name, f.Name, f.Type)
+        }
+    }
+    for i := range m.RowRules {
+        if err := m.RowRules[i].compile(); err != nil {
+            return nil, fmt.Errorf("mapping %s: rowRules[%d]: %w", name, i, err)
+        }
+    }
+    return &m, nil
+}
+
+// columnsResult is the outcome of applying a Mapping to a header row.
+type columnsResult struct {
+    // Keys holds the data_json key of every column: the canonical name
+    // for mapped columns and the normalized header otherwise.
+    Keys            []string
+    Unmapped        []string
+    MissingRequired []string
+}
+
+// resolve matches raw headers against the mapping. Each field is matched
+// at most once; later columns matching the same field stay unmapped.
+func (m *Mapping) resolve(raw []string) columnsResult {
+    lookup := m.lookup()
+    res := columnsResult{Keys: make([]string, len(raw))}
+    used := map[string]bool{}
+    for i, h := range raw {
+        if name, ok := lookup[headerKey(h)]; ok && !used[name] {
+            used[name] = true
+            res.Keys[i] = name
+            continue
+        }
+        res.Keys[i] = normalizeHeader(h, i)
+        if strings.TrimSpace(h) != "" {
+            res.Unmapped = append(res.Unmapped, strings.TrimSpace(h))
+        }
+    }
+    res.Keys = uniqueKeys(res.Keys)
+    for _, f := range m.Fields {
+        if f.Required && !used[f.Name] {
+            res.MissingRequired = append(res.MissingRequired, f.Name)
+        }
+    }
+    return res
+}
+
+// types returns the declared type of every typed field, with the types
+// the bateo_ventas table needs filled in.
+func (m *Mapping) types() map[string]string {
+    t := map[string]string{}
+    for k, v := range ventasTypes {
+        t[k] = v
+    }
+    for _, f := range m.Fields {
+        if f.Type != "" {
+            t[f.Name] = f.Type
+        }
+    }
+    return t
+}
+
+// lookup maps the headerKey of every name and alias to its field name.
+func (m *Mapping) lookup() map[string]string {
+    lookup := map[string]string{}
+    for _, f := range m.Fields {
+        for _, a := range append([]string{f.Name}, f.Aliases...) {
+            if k := headerKey(a); k != "" {
+                if _, dup := lookup[k]; !dup {
+                    lookup[k] = f.Name
+                }
+            }
+        }
+    }
+    return lookup
+}
+
+// headerKey folds a header for matching: lower case, no accents, and runs
+// of anything other than letters and digits collapsed to one space.
+func headerKey(h string) string {
+    var b strings.Builder
+    space := false
+    for _, r := range foldAccents(strings.ToLower(h)) {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            if space && b.Len() > 0 {
+                b.WriteByte(' ')
+            }
+            space = false
+            b.WriteRune(r)
+            continue
+        }
+        space = true
+    }
+    return b.String()
+}
+
+var accentFold = map[rune]rune{
+    'á': 'a', 'à': 'a', 'â': 'a', 'ä': 'a', 'ã': 'a',
+    'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e',
+    'í': 'i', 'ì': 'i', 'î': 'i', 'ï': 'i',
+    'ó': 'o', 'ò': 'o', 'ô': 'o', 'ö': 'o', 'õ': 'o',
+    'ú': 'u', 'ù': 'u', 'û': 'u', 'ü': 'u',
+    'ñ': 'n', 'ç': 'c',
+    'Á': 'A', 'À': 'A', 'Â': 'A', 'Ä': 'A', 'Ã': 'A',
+    'É': 'E', 'È': 'E', 'Ê': 'E', 'Ë': 'E',
+    'Í': 'I', 'Ì': 'I', 'Î': 'I', 'Ï': 'I',
+    'Ó': 'O', 'Ò': 'O', 'Ô': 'O', 'Ö': 'O', 'Õ': 'O',
+    'Ú': 'U', 'Ù': 'U', 'Û': 'U', 'Ü': 'U',
+    'Ñ': 'N', 'Ç': 'C',
+}
+
+// foldAccents replaces the accented Latin letters used in Spanish (and a
+// few neighbours) with their unaccented form.
+func foldAccents(s string) string {
+    return strings.Map(func(r rune) rune {
+        if f, ok := accentFold[r]; ok {
+            return f
+        }
+        return r
+    }, s)
+}
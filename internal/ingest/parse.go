@@ -0,0 +1,221 @@
+package ingest
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Column types a Field can declare. Values of typed columns are parsed into
+// canonical form (numbers, YYYY-MM-DD dates) next to their original text.
+const (
+    TypeText     = "text"
+    TypeNumber   = "number"
+    TypeCurrency = "currency"
+    TypePercent  = "percent"
+    TypeDate     = "date"
+)
+
+// DefaultLocale is used when neither Options nor the mapping name one.
+const DefaultLocale = "es-MX"
+
+// Locale describes how a report writes numbers and dates.
+type Locale struct {
+    Name      string
+    Decimal   byte
+    Thousands byte // 0 when numbers carry no thousands separator
+    DayFirst  bool // 15/10/2025 rather than 10/15/2025
+}
+
+// Locales are the locales reports can be parsed with.
+var Locales = map[string]Locale{
+    "es-MX": {Name: "es-MX", Decimal: '.', Thousands: ',', DayFirst: true},
+    "es-ES": {Name: "es-ES", Decimal: ',', Thousands: '.', DayFirst: true},
+    "en-US": {Name: "en-US", Decimal: '.', Thousands: ',', DayFirst: false},
+}
+
+// rawLocale reads raw cell values (see sheet.Raw): plain decimals and
+// ISO dates or Excel serial numbers.
+var rawLocale = Locale{Name: "raw", Decimal: '.'}
+
+// LookupLocale returns the named locale, DefaultLocale when name is empty.
+func LookupLocale(name string) (Locale, error) {
+    if name == "" {
+        name = DefaultLocale
+    }
+    l, ok := Locales[name]
+    if !ok {
+        return Locale{}, fmt.Errorf("unknown locale %q", name)
+    }
+    return l, nil
+}
+
+// Parse converts s according to typ. Numbers come back as float64 and dates
+// as YYYY-MM-DD strings; ok is false for text columns, empty cells and
+// values that do not parse.
+func (l Locale) Parse(typ, s string) (any, bool) {
+    switch typ {
+    case TypeNumber, TypeCurrency, TypePercent:
+        if f, ok := l.ParseNumber(s); ok {
+            return f, true
+        }
+    case TypeDate:
+        if d, ok := l.ParseDate(s); ok {
+            return d, true
+        }
+    }
+    return nil, false
+}
+
+// ParseNumber reads amounts such as "$1,234.50", "1.234,50", "(150.00)",
+// "-3", "20.94%" or "1,234.50 MXN". Parentheses and a leading or trailing
+// minus mean negative. Percentages keep their displayed value (20.94).
+//
+// When a number has both separators the last one is the decimal point.
+// With a single separator that appears once and is followed by exactly
+// three digits, the locale decides whether it groups thousands; any other
+// single separator appearing more than once groups thousands, and once it
+// is the decimal point.
+func (l Locale) ParseNumber(s string) (float64, bool) {
+    s = strings.TrimSpace(s)
+    neg := false
+    if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+        neg, s = true, s[1:len(s)-1]
+    }
+    s = strings.NewReplacer("$", "", "MXN", "", "M.N.", "", "USD", "", "€", "", "%", "", " ", "", " ", "").Replace(s)
+    if strings.HasPrefix(s, "-") {
+        neg, s = !neg, s[1:]
+    } else if strings.HasSuffix(s, "-") {
+        neg, s = !neg, s[:len(s)-1]
+    }
+    s = strings.TrimPrefix(s, "+")
+    if s == "" {
+        return 0, false
+    }
+    for i := 0; i < len(s); i++ {
+        if c := s[i]; (c < '0' || c > '9') && c != '.' && c != ',' {
+            return 0, false
+        }
+    }
+
+    dot, comma := strings.LastIndexByte(s, '.'), strings.LastIndexByte(s, ',')
+    var dec byte
+    switch {
+    case dot >= 0 && comma >= 0:
+        dec = '.'
+        if comma > dot {
+            dec = ','
+        }
+    case dot >= 0 || comma >= 0:
+        sep := byte('.')
+        if comma >= 0 {
+            sep = ','
+        }
+        idx := strings.LastIndexByte(s, sep)
+        switch {
+        case strings.Count(s, string(sep)) > 1:
+            dec = 0
+        case len(s)-idx-1 == 3 && sep == l.Thousands:
+            dec = 0
+        default:
+            dec = sep
+        }
+    }
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        switch c := s[i]; {
+        case c == dec:
+            b.WriteByte('.')
+        case c == '.' || c == ',':
+            // thousands separator
+        default:
+            b.WriteByte(c)
+        }
+    }
+    f, err := strconv.ParseFloat(b.String(), 64)
+    if err != nil || math.IsInf(f, 0) {
+        return 0, false
+    }
+    if neg {
+        f = -f
+    }
+    return f, true
+}
+
+// excelEpoch is day zero of Excel's 1900 date system (counting its
+// fictitious 1900-02-29).
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// maxExcelSerial is 9999-12-31.
+const maxExcelSerial = 2958465
+
+// excelSerial matches a plain serial day number, with an optional time of
+// day as fraction. ParseFloat alone would also take "NaN", "Inf" or "1e5".
+var excelSerial = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+var spanishMonths = strings.NewReplacer(
+    "enero", "Jan", "febrero", "Feb", "marzo", "Mar", "abril", "Apr", "mayo", "May", "junio", "Jun",
+    "julio", "Jul", "agosto", "Aug", "septiembre", "Sep", "setiembre", "Sep", "octubre", "Oct",
+    "noviembre", "Nov", "diciembre", "Dec",
+    "ene", "Jan", "abr", "Apr", "ago", "Aug", "sept", "Sep", "dic", "Dec",
+)
+
+// ParseDate returns s as YYYY-MM-DD. It accepts ISO dates, day/month/year
+// (or month/day/year, per the locale) with / - or . separators and an
+// optional time, Spanish month names ("15-oct-2025", "15 de octubre de
+// 2025") and Excel serial day numbers.
+func (l Locale) ParseDate(s string) (string, bool) {
+    s = strings.TrimSpace(s)
+    if s == "" {
+        return "", false
+    }
+    if excelSerial.MatchString(s) {
+        f, err := strconv.ParseFloat(s, 64)
+        if err != nil || f < 1 || f > maxExcelSerial {
+            return "", false
+        }
+        return excelEpoch.AddDate(0, 0, int(f)).Format("2006-01-02"), true
+    }
+
+    layouts := []string{"2006-01-02", "2006/01/02", "2006-01-02T15:04:05Z07:00"}
+    dm := []string{"02/01/2006", "2/1/2006", "02-01-2006", "2-1-2006", "02.01.2006", "02/01/06", "2/1/06"}
+    if !l.DayFirst {
+        dm = []string{"01/02/2006", "1/2/2006", "01-02-2006", "1-2-2006", "01.02.2006", "01/02/06", "1/2/06"}
+    }
+    layouts = append(layouts, dm...)
+    layouts = append(layouts, "02-Jan-2006", "2-Jan-2006", "02/Jan/2006", "2 Jan 2006", "02-Jan-06")
+
+    v := s
+    // drop a time of day: "15/10/2025 13:45:00", "2025-10-15 00:00"
+    if i := strings.IndexByte(v, ' '); i > 0 && strings.Contains(v[i:], ":") {
+        v = v[:i]
+    }
+    candidates := []string{v}
+    if strings.IndexFunc(v, func(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' }) >= 0 {
+        // Spanish month names; the text as given is still tried first so
+        // timestamps such as 2025-10-15T00:00:00Z keep their T and Z
+        m := strings.ToLower(foldAccents(v))
+        m = strings.ReplaceAll(m, " de ", " ")
+        candidates = append(candidates, spanishMonths.Replace(m))
+    }
+    for _, c := range candidates {
+        for _, layout := range layouts {
+            if t, err := time.Parse(layout, c); err == nil {
+                return t.Format("2006-01-02"), true
+            }
+        }
+    }
+    return "", false
+}
+
+// parseNumber and parseDate read values with the default locale.
+func parseNumber(s string) (float64, bool) {
+    return Locales[DefaultLocale].ParseNumber(s)
+}
+
+func parseDate(s string) (string, bool) {
+    return Locales[DefaultLocale].ParseDate(s)
+}
@@ -0,0 +1,154 @@
+package ingest
+
+import (
+    "testing"
+)
+
+func TestParseNumber(t *testing.T) {
+    tests := []struct {
+        locale string
+        in     string
+        want   float64
+        ok     bool
+    }{
+        {locale: "es-MX", in: "$1,234.50", want: 1234.5, ok: true},
+        {locale: "es-MX", in: "1.234,50", want: 1234.5, ok: true},
+        {locale: "es-MX", in: "(150.00)", want: -150, ok: true},
+        {locale: "es-MX", in: "-3", want: -3, ok: true},
+        {locale: "es-MX", in: "3-", want: -3, ok: true},
+        {locale: "es-MX", in: "+7", want: 7, ok: true},
+        {locale: "es-MX", in: "20.94%", want: 20.94, ok: true},
+        {locale: "es-MX", in: "1,234.50 MXN", want: 1234.5, ok: true},
+        {locale: "es-MX", in: "1,234,567", want: 1234567, ok: true},
+        {locale: "es-MX", in: "1,234", want: 1234, ok: true},
+        {locale: "es-MX", in: "12,5", want: 12.5, ok: true},
+        {locale: "es-MX", in: "1.234", want: 1.234, ok: true},
+        {locale: "es-ES", in: "1.234", want: 1234, ok: true},
+        {locale: "es-ES", in: "1,234", want: 1.234, ok: true},
+        {locale: "es-ES", in: "1.234,50 €", want: 1234.5, ok: true},
+        {locale: "en-US", in: "1,234.50", want: 1234.5, ok: true},
+        {locale: "es-MX", in: ""},
+        {locale: "es-MX", in: "$"},
+        {locale: "es-MX", in: "abc"},
+        {locale: "es-MX", in: "1e5"},
+        {locale: "es-MX", in: "N/A"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.locale+" "+tt.in, func(t *testing.T) {
+            got, ok := Locales[tt.locale].ParseNumber(tt.in)
+            if ok != tt.ok || got != tt.want {
+                t.Fatalf("ParseNumber(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+            }
+        })
+    }
+}
+
+func TestParseDate(t *testing.T) {
+    tests := []struct {
+        locale string
+        in     string
+        want   string
+    }{
+        {locale: "es-MX", in: "2025-10-15", want: "2025-10-15"},
+        {locale: "es-MX", in: "2025-10-15T00:00:00Z", want: "2025-10-15"},
+        {locale: "es-MX", in: "15/10/2025", want: "2025-10-15"},
+        {locale: "es-MX", in: "5/1/2025", want: "2025-01-05"},
+        {locale: "es-MX", in: "15-10-2025", want: "2025-10-15"},
+        {locale: "es-MX", in: "15.10.2025", want: "2025-10-15"},
+        {locale: "es-MX", in: "15/10/25", want: "2025-10-15"},
+        {locale: "es-MX", in: "15/10/2025 13:45:00", want: "2025-10-15"},
+        {locale: "es-MX", in: "15-oct-2025", want: "2025-10-15"},
+        {locale: "es-MX", in: "15 de octubre de 2025", want: "2025-10-15"},
+        {locale: "es-MX", in: "1 de Enero de 2025", want: "2025-01-01"},
+        {locale: "es-MX", in: "45945", want: "2025-10-15"},
+        {locale: "es-MX", in: "45945.75", want: "2025-10-15"},
+        {locale: "en-US", in: "10/15/2025", want: "2025-10-15"},
+        {locale: "es-MX", in: "10/15/2025"},
+        {locale: "es-MX", in: "31/02/2025"},
+        {locale: "es-MX", in: "0"},
+        {locale: "es-MX", in: "NaN"},
+        {locale: "es-MX", in: "Inf"},
+        {locale: "es-MX", in: "1e5"},
+        {locale: "es-MX", in: ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.locale+" "+tt.in, func(t *testing.T) {
+            got, ok := Locales[tt.locale].ParseDate(tt.in)
+            if ok != (tt.want != "") || got != tt.want {
+                t.Fatalf("ParseDate(%q) = %q, %v, want %q", tt.in, got, ok, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseByType(t *testing.T) {
+    l := Locales[DefaultLocale]
+    tests := []struct {
+        typ  string
+        in   string
+        want any
+    }{
+        {typ: TypeNumber, in: "1,234", want: 1234.0},
+        {typ: TypeCurrency, in: "$10.50", want: 10.5},
+        {typ: TypePercent, in: "22.07%", want: 22.07},
+        {typ: TypeDate, in: "15/10/2025", want: "2025-10-15"},
+        {typ: TypeText, in: "15/10/2025"},
+        {typ: TypeNumber, in: "n/a"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.typ+" "+tt.in, func(t *testing.T) {
+            got, ok := l.Parse(tt.typ, tt.in)
+            if ok != (tt.want != nil) || got != tt.want {
+                t.Fatalf("Parse(%s, %q) = %v, %v, want %v", tt.typ, tt.in, got, ok, tt.want)
+            }
+        })
+    }
+}
+
+// sheet.parse prefers the raw cell value and keeps percentages on the
+// displayed scale whatever the file format.
+func TestSheetParse(t *testing.T) {
+    tests := []struct {
+        name string
+        sh   sheet
+        typ  string
+        text string
+        want any
+    }{
+        {name: "xlsx percent", sh: sheet{Raw: [][]string{{"0.2094"}}}, typ: TypePercent, text: "20.94%", want: 20.94},
+        {name: "csv percent", typ: TypePercent, text: "20.94", want: 20.94},
+        {name: "csv percent sign", typ: TypePercent, text: "20.94%", want: 20.94},
+        {name: "xlsx date serial", sh: sheet{Raw: [][]string{{"45945"}}}, typ: TypeDate, text: "10-15-25", want: "2025-10-15"},
+        {name: "xlsx full precision", sh: sheet{Raw: [][]string{{"1234.5678"}}}, typ: TypeCurrency, text: "$1,234.57", want: 1234.5678},
+        {name: "raw same as text", sh: sheet{Raw: [][]string{{"10"}}}, typ: TypeNumber, text: "10", want: 10.0},
+        {name: "xls year and month only", sh: sheet{XLS: true}, typ: TypeDate, text: "2025.10"},
+        {name: "xls timestamp", sh: sheet{XLS: true, Raw: [][]string{{xlsRaw("2025-10-15T00:00:00Z")}}}, typ: TypeDate, text: "2025-10-15T00:00:00Z", want: "2025-10-15"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, ok := tt.sh.parse(Locales[DefaultLocale], tt.typ, 0, 0, tt.text)
+            if ok != (tt.want != nil) || got != tt.want {
+                t.Fatalf("parse(%s, %q) = %v, %v, want %v", tt.typ, tt.text, got, ok, tt.want)
+            }
+        })
+    }
+}
+
+func TestXLSRaw(t *testing.T) {
+    tests := []struct {
+        in   string
+        want string
+    }{
+        {in: "2025-10-15T00:00:00Z", want: "45945"},
+        {in: "2025-10-15T12:00:00Z", want: "45945.5"},
+        {in: "15/10/2025"},
+        {in: "22.07"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.in, func(t *testing.T) {
+            if got := xlsRaw(tt.in); got != tt.want {
+                t.Fatalf("xlsRaw(%q) = %q, want %q", tt.in, got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,194 @@
+package ingest
+
+import (
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/xuri/excelize/v2"
+    xls "github.com/extrame/xls"
+)
+
+// Table is the data of an export file as displayed text: its header row,
+// the data key of each header cell and the detail rows below it. Rows may
+// have different lengths.
+type Table struct {
+    Header []string
+    Keys   []string
+    Rows   [][]string
+}
+
+// ReadTable reads the first sheet of an export file (.xlsx, .xls or .csv)
+// and keeps the rows Ingest would store as data: the rows above the
+// detected header row, empty rows and the subtotal/total rows of the
+// report type's rowRules are left out.
+func ReadTable(exportPath, reportType string) (Table, error) {
+    var t Table
+    m, err := LoadMapping(reportType)
+    if err != nil {
+        return t, err
+    }
+    s, err := readSheet(exportPath)
+    if err != nil || len(s.Rows) == 0 {
+        return t, err
+    }
+    h := detectHeader(s.Rows, m)
+    t.Header = s.Rows[h]
+    t.Keys = m.resolve(t.Header).Keys
+    for _, r := range s.Rows[h+1:] {
+        data := rowData(t.Keys, r)
+        if rowIsEmpty(data) {
+            continue
+        }
+        if kind, _ := m.classify(t.Keys, data); kind != RowDetail {
+            continue
+        }
+        t.Rows = append(t.Rows, r)
+    }
+    return t, nil
+}
+
+// sheet is the first sheet of an export file. Raw holds unformatted cell
+// values (plain decimals, date serial numbers) at the same positions as
+// Rows: every cell for .xlsx, and for .xls only the cells extrame/xls
+// renders as timestamps. XLS is set for .xls files.
+type sheet struct {
+    Rows [][]string
+    Raw  [][]string
+    XLS  bool
+}
+
+// xlsMonth is how extrame/xls renders cells with a built-in date format:
+// year and month only, without the day.
+var xlsMonth = regexp.MustCompile(`^\d{4}\.(0[1-9]|1[0-2])$`)
+
+// parse converts the cell at row, col, displayed as text, according to typ.
+// The raw value is preferred when it differs from the displayed text, so
+// date serials and full-precision decimals are read as stored. Percentages
+// keep the displayed scale (20.94, not 0.2094) whatever the file format.
+func (s sheet) parse(loc Locale, typ string, row, col int, text string) (any, bool) {
+    if s.XLS && typ == TypeDate && xlsMonth.MatchString(strings.TrimSpace(text)) {
+        // the day is lost; better no date than a wrong one
+        return nil, false
+    }
+    if raw := s.rawCell(row, col); raw != "" && raw != text {
+        if v, ok := rawLocale.Parse(typ, raw); ok {
+            if f, isNum := v.(float64); isNum && typ == TypePercent && strings.HasSuffix(strings.TrimSpace(text), "%") {
+                // percent-formatted cells store the fraction
+                v = math.Round(f*100*1e9) / 1e9
+            }
+            return v, true
+        }
+    }
+    return loc.Parse(typ, text)
+}
+
+// xlsRaw returns the Excel serial of a cell extrame/xls rendered as an
+// RFC 3339 timestamp, which it does for every number with a custom format,
+// or "" for any other cell.
+func xlsRaw(text string) string {
+    t, err := time.Parse(time.RFC3339, text)
+    if err != nil {
+        return ""
+    }
+    days := t.Sub(excelEpoch).Hours() / 24
+    return strconv.FormatFloat(days, 'f', -1, 64)
+}
+
+// rawCell returns the unformatted value of a cell, or "" when there is none.
+func (s sheet) rawCell(row, col int) string {
+    if row < len(s.Raw) && col < len(s.Raw[row]) {
+        return s.Raw[row][col]
+    }
+    return ""
+}
+
+func readSheet(exportPath string) (sheet, error) {
+    var out sheet
+    switch ext := strings.ToLower(filepath.Ext(exportPath)); ext {
+    case ".xlsx":
+        f, err := excelize.OpenFile(exportPath)
+        if err != nil {
+            return out, err
+        }
+        defer func() { _ = f.Close() }()
+        sheets := f.GetSheetList()
+        if len(sheets) == 0 {
+            return out, errors.New("xlsx has no sheets")
+        }
+        if out.Rows, err = f.GetRows(sheets[0]); err != nil {
+            return out, err
+        }
+        out.Raw, err = f.GetRows(sheets[0], excelize.Options{RawCellValue: true})
+        return out, err
+
+    case ".xls":
+        wb, err := xls.Open(exportPath, "utf-8")
+        if err != nil {
+            return out, err
+        }
+        if wb.NumSheets() == 0 {
+            return out, errors.New("xls has no sheets")
+        }
+        sh := wb.GetSheet(0)
+        if sh == nil {
+            return out, errors.New("failed to open first xls sheet")
+        }
+        out.XLS = true
+        for r := 0; r <= int(sh.MaxRow); r++ {
+            row := sh.Row(r)
+            if row == nil {
+                // keep indices aligned with the sheet
+                out.Rows = append(out.Rows, nil)
+                out.Raw = append(out.Raw, nil)
+                continue
+            }
+            cols := row.LastCol()
+            rec := make([]string, cols)
+            var raw []string
+            for i := 0; i < cols; i++ {
+                rec[i] = row.Col(i)
+                if v := xlsRaw(rec[i]); v != "" {
+                    if raw == nil {
+                        raw = make([]string, cols)
+                    }
+                    raw[i] = v
+                }
+            }
+            out.Rows = append(out.Rows, rec)
+            out.Raw = append(out.Raw, raw)
+        }
+        return out, nil
+
+    case ".csv":
+        fi, err := os.Open(exportPath)
+        if err != nil {
+            return out, err
+        }
+        defer fi.Close()
+        r := csv.NewReader(fi)
+        r.FieldsPerRecord = -1
+        for {
+            rec, err := r.Read()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                return out, err
+            }
+            out.Rows = append(out.Rows, rec)
+        }
+        return out, nil
+
+    default:
+        return out, fmt.Errorf("unsupported export extension: %s", ext)
+    }
+}
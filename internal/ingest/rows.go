@@ -0,0 +1,93 @@
+package ingest
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// Row kinds. Only detail rows are stored as data; subtotal and total rows
+// are the report's own aggregates and go to batch_totals.
+const (
+    RowDetail   = "detail"
+    RowSubtotal = "subtotal"
+    RowTotal    = "total"
+)
+
+// RowRule marks a row as a subtotal or total when Match (a regular
+// expression) matches the cell of Column or, when Column is empty, the
+// first non-empty cell of the row, where reports put their labels. Cells
+// are folded with headerKey first ("Total General" → "total general").
+// Rules are tried in order; the first match wins.
+type RowRule struct {
+    Kind   string `json:"kind"`
+    Column string `json:"column,omitempty"`
+    Match  string `json:"match"`
+
+    re *regexp.Regexp
+}
+
+func (r *RowRule) compile() error {
+    if r.Kind != RowSubtotal && r.Kind != RowTotal {
+        return fmt.Errorf("kind must be %q or %q", RowSubtotal, RowTotal)
+    }
+    re, err := regexp.Compile(r.Match)
+    if err != nil {
+        return err
+    }
+    r.re = re
+    return nil
+}
+
+// classify returns the kind of a row and, for subtotal/total rows, the text
+// of the cell that matched. keys gives the column order of data.
+func (m *Mapping) classify(keys []string, data map[string]string) (kind, label string) {
+    for _, r := range m.RowRules {
+        if r.re == nil {
+            continue
+        }
+        for _, k := range keys {
+            if r.Column != "" && k != r.Column {
+                continue
+            }
+            v := strings.TrimSpace(data[k])
+            if v == "" {
+                continue
+            }
+            if r.re.MatchString(headerKey(v)) {
+                return r.Kind, v
+            }
+            break
+        }
+    }
+    return RowDetail, ""
+}
+
+func initTotalsSchema(db *sql.DB) error {
+    stmts := []string{
+        `CREATE TABLE IF NOT EXISTS batch_totals (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            batch_id  INTEGER NOT NULL,
+            row_index INTEGER NOT NULL,
+            kind      TEXT NOT NULL,
+            label     TEXT NOT NULL,
+            data_json TEXT NOT NULL,
+            FOREIGN KEY(batch_id) REFERENCES ingest_batches(id)
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_batch_totals_batch ON batch_totals(batch_id);`,
+    }
+    for _, s := range stmts {
+        if _, err := db.Exec(s); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func insertTotalRow(tx *sql.Tx, batchID int64, rowIndex int, kind, label string, data map[string]string) error {
+    b, _ := json.Marshal(data)
+    _, err := tx.Exec(`INSERT INTO batch_totals(batch_id, row_index, kind, label, data_json) VALUES(?,?,?,?,?)`, batchID, rowIndex, kind, label, string(b))
+    return err
+}
@@ -0,0 +1,149 @@
+package ingest
+
+import (
+    "database/sql"
+    "strings"
+)
+
+// ventasColumns are the canonical fields (see the bateo_ventas mapping)
+// copied into the typed bateo_ventas table.
+var ventasColumns = []string{
+    "zona", "sucursal", "nombre_sucursal", "vendedor", "empresa",
+    "fecha", "ticket", "sku", "producto", "cantidad", "precio", "importe",
+    "tickets_con_solicitados", "combinaciones_con_sugeridos", "porcentaje_bateo",
+}
+
+// ventasAdded are the typed columns added after the initial schema. When a
+// column is added, existing rows are filled in from bateo_ventas_rows.
+var ventasAdded = [][2]string{
+    {"ticket", "TEXT"},
+    {"zona", "TEXT"},
+    {"nombre_sucursal", "TEXT"},
+    {"vendedor", "TEXT"},
+    {"empresa", "TEXT"},
+    {"tickets_con_solicitados", "REAL"},
+    {"combinaciones_con_sugeridos", "REAL"},
+    {"porcentaje_bateo", "REAL"},
+}
+
+func initVentasSchema(db *sql.DB) error {
+    stmts := []string{
+        `CREATE TABLE IF NOT EXISTS bateo_ventas (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            batch_id  INTEGER NOT NULL,
+            row_id    INTEGER NOT NULL,
+            row_index INTEGER NOT NULL,
+            sucursal  TEXT,
+            fecha     TEXT,
+            sku       TEXT,
+            producto  TEXT,
+            cantidad  REAL,
+            precio    REAL,
+            importe   REAL,
+            FOREIGN KEY(batch_id) REFERENCES ingest_batches(id),
+            FOREIGN KEY(row_id) REFERENCES bateo_ventas_rows(id)
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_bateo_ventas_batch ON bateo_ventas(batch_id);`,
+        `CREATE INDEX IF NOT EXISTS idx_bateo_ventas_fecha ON bateo_ventas(fecha);`,
+        `CREATE INDEX IF NOT EXISTS idx_bateo_ventas_sucursal ON bateo_ventas(sucursal, fecha);`,
+        `CREATE INDEX IF NOT EXISTS idx_bateo_ventas_sku ON bateo_ventas(sku);`,
+    }
+    for _, s := range stmts {
+        if _, err := db.Exec(s); err != nil {
+            return err
+        }
+    }
+    // columns added after the initial schema
+    for _, c := range ventasAdded {
+        exists, err := hasColumn(db, "bateo_ventas", c[0])
+        if err != nil {
+            return err
+        }
+        if exists {
+            continue
+        }
+        if err := ensureColumn(db, "bateo_ventas", c[0], c[1]); err != nil {
+            return err
+        }
+        if err := backfillVentasColumn(db, c[0], c[1] == "REAL"); err != nil {
+            return err
+        }
+    }
+    for _, s := range []string{
+        `CREATE INDEX IF NOT EXISTS idx_bateo_ventas_zona ON bateo_ventas(zona, sucursal);`,
+        `CREATE INDEX IF NOT EXISTS idx_bateo_ventas_vendedor ON bateo_ventas(vendedor);`,
+        // typed rows were once written for every report type
+        `DELETE FROM bateo_ventas WHERE batch_id IN (
+            SELECT id FROM ingest_batches WHERE report_type IS NOT NULL AND report_type <> '` + DefaultReportType + `')`,
+    } {
+        if _, err := db.Exec(s); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// backfillVentasColumn fills a newly added typed column from the stored
+// rows: numbers from values_json, text from data_json.
+func backfillVentasColumn(db *sql.DB, column string, numeric bool) error {
+    src := `NULLIF(json_extract(r.data_json, ?), '')`
+    if numeric {
+        src = `json_extract(r.values_json, ?)`
+    }
+    _, err := db.Exec(`UPDATE bateo_ventas SET `+column+` = (
+            SELECT `+src+` FROM bateo_ventas_rows r WHERE r.id = bateo_ventas.row_id)`,
+        jsonPath(column))
+    return err
+}
+
+// ventasMapping returns, for each typed column, the data key it is read
+// from. Columns the report does not have are left out.
+func ventasMapping(headers []string) map[string]string {
+    present := make(map[string]bool, len(headers))
+    for _, h := range headers {
+        present[h] = true
+    }
+    m := map[string]string{}
+    for _, c := range ventasColumns {
+        if present[c] {
+            m[c] = c
+        }
+    }
+    return m
+}
+
+// ventasTypes are the column types the typed table needs. They apply when
+// the mapping does not declare a type for the field. Columns without a type
+// are stored as text.
+var ventasTypes = map[string]string{
+    "fecha":                       TypeDate,
+    "cantidad":                    TypeNumber,
+    "precio":                      TypeCurrency,
+    "importe":                     TypeCurrency,
+    "tickets_con_solicitados":     TypeNumber,
+    "combinaciones_con_sugeridos": TypeNumber,
+    "porcentaje_bateo":            TypePercent,
+}
+
+// insertVentasRow stores the typed view of one ingested row from its parsed
+// values. Values that did not parse are stored as NULL; the original text
+// stays in bateo_ventas_rows.
+func insertVentasRow(tx *sql.Tx, batchID, rowID int64, rowIndex int, mapping map[string]string, data map[string]string, values map[string]any) error {
+    args := []any{batchID, rowID, rowIndex}
+    for _, c := range ventasColumns {
+        h, ok := mapping[c]
+        switch {
+        case !ok:
+            args = append(args, nil)
+        case ventasTypes[c] != "":
+            args = append(args, values[h])
+        case data[h] == "":
+            args = append(args, nil)
+        default:
+            args = append(args, data[h])
+        }
+    }
+    _, err := tx.Exec(`INSERT INTO bateo_ventas(batch_id, row_id, row_index, `+strings.Join(ventasColumns, ", ")+`)
+        VALUES(?,?,?`+strings.Repeat(",?", len(ventasColumns))+`)`, args...)
+    return err
+}
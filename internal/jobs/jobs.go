@@ -0,0 +1,279 @@
+package jobs
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "io"
+    "sort"
+    "sync"
+    "time"
+
+    "automation/api/internal/runner"
+)
+
+type Status string
+
+const (
+    StatusQueued    Status = "queued"
+    StatusRunning   Status = "running"
+    StatusSucceeded Status = "succeeded"
+    StatusFailed    Status = "failed"
+    StatusCanceled  Status = "canceled"
+)
+
+var (
+    ErrNotFound = errors.New("job not found")
+    ErrFinished = errors.New("job already finished")
+)
+
+// Func performs the work of a job. It must honour ctx cancellation and run
+// its commands through h.Attach so output is streamed and the job status
+// follows the runner queue. The optional second return value is exposed as
+// Job.Output (e.g. ingest info).
+type Func func(ctx context.Context, h Hooks) (runner.ExecResult, any)
+
+// Hooks connect runner commands to a job.
+type Hooks struct {
+    Stdout   io.Writer
+    Stderr   io.Writer
+    onQueued func(position int)
+    onStart  func()
+    report   func(v any)
+}
+
+// Report publishes partial output (e.g. per-item progress) as Job.Output
+// while the job is still running.
+func (h Hooks) Report(v any) {
+    if h.report != nil {
+        h.report(v)
+    }
+}
+
+// Attach routes the command's output to the job log and its queue events to
+// the job status.
+func (h Hooks) Attach(c runner.Command) runner.Command {
+    c.Stdout, c.Stderr = h.Stdout, h.Stderr
+    c.OnQueued, c.OnStart = h.onQueued, h.onStart
+    return c
+}
+
+type Job struct {
+    ID         string             `json:"id"`
+    Kind       string             `json:"kind"`
+    Params     any                `json:"params,omitempty"`
+    Status     Status             `json:"status"`
+    // QueuePosition is the 1-based position in the runner queue while queued.
+    QueuePosition int             `json:"queuePosition,omitempty"`
+    CreatedAt  time.Time          `json:"createdAt"`
+    StartedAt  *time.Time         `json:"startedAt,omitempty"`
+    FinishedAt *time.Time         `json:"finishedAt,omitempty"`
+    Result     *runner.ExecResult `json:"result,omitempty"`
+    Output     any                `json:"output,omitempty"`
+    Error      string             `json:"error,omitempty"`
+
+    cancel context.CancelFunc
+    log    *Log
+    done   chan struct{}
+}
+
+// Done reports whether the job reached a terminal status.
+func (j Job) Done() bool {
+    return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCanceled
+}
+
+// Manager keeps jobs in memory. Finished jobs are pruned after the retention
+// period.
+type Manager struct {
+    mu        sync.Mutex
+    jobs      map[string]*Job
+    retention time.Duration
+}
+
+func NewManager(retention time.Duration) *Manager {
+    return &Manager{jobs: map[string]*Job{}, retention: retention}
+}
+
+// Submit registers a job and starts it in the background. It returns the
+// job as queued.
+func (m *Manager) Submit(kind string, params any, fn Func) Job {
+    ctx, cancel := context.WithCancel(context.Background())
+    j := &Job{
+        ID:        newID(),
+        Kind:      kind,
+        Params:    params,
+        Status:    StatusQueued,
+        CreatedAt: time.Now().UTC(),
+        cancel:    cancel,
+        log:       newLog(),
+        done:      make(chan struct{}),
+    }
+
+    m.mu.Lock()
+    m.pruneLocked()
+    m.jobs[j.ID] = j
+    snap := *j
+    m.mu.Unlock()
+
+    go m.execute(ctx, j, fn)
+    return snap
+}
+
+func (m *Manager) execute(ctx context.Context, j *Job, fn Func) {
+    defer close(j.done)
+    defer j.cancel()
+    defer j.log.close()
+
+    m.mu.Lock()
+    if j.Status == StatusCanceled {
+        m.mu.Unlock()
+        return
+    }
+    m.mu.Unlock()
+
+    stdout := &lineWriter{log: j.log, stream: "stdout"}
+    stderr := &lineWriter{log: j.log, stream: "stderr"}
+    h := Hooks{
+        Stdout: stdout,
+        Stderr: stderr,
+        onQueued: func(position int) {
+            m.mu.Lock()
+            defer m.mu.Unlock()
+            if j.Status == StatusQueued {
+                j.QueuePosition = position
+            }
+        },
+        report: func(v any) {
+            m.mu.Lock()
+            defer m.mu.Unlock()
+            j.Output = v
+        },
+        onStart: func() {
+            m.mu.Lock()
+            defer m.mu.Unlock()
+            j.QueuePosition = 0
+            if j.Status == StatusQueued {
+                now := time.Now().UTC()
+                j.Status = StatusRunning
+                j.StartedAt = &now
+            }
+        },
+    }
+    res, out := fn(ctx, h)
+    stdout.flush()
+    stderr.flush()
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    done := time.Now().UTC()
+    j.FinishedAt = &done
+    j.QueuePosition = 0
+    j.Result = &res
+    j.Output = out
+    switch {
+    case ctx.Err() != nil:
+        j.Status = StatusCanceled
+    case res.OK:
+        j.Status = StatusSucceeded
+    default:
+        j.Status = StatusFailed
+        j.Error = res.Error
+    }
+    if res.Err() != nil {
+        // never ran (e.g. queue full); drop the placeholder result
+        j.Result = nil
+    }
+}
+
+// Get returns a snapshot of the job.
+func (m *Manager) Get(id string) (Job, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    j, ok := m.jobs[id]
+    if !ok {
+        return Job{}, false
+    }
+    return *j, true
+}
+
+// Wait blocks until the job finishes or ctx is done and returns its final
+// snapshot.
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+    m.mu.Lock()
+    j, ok := m.jobs[id]
+    m.mu.Unlock()
+    if !ok {
+        return Job{}, ErrNotFound
+    }
+    select {
+    case <-j.done:
+    case <-ctx.Done():
+        return Job{}, ctx.Err()
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return *j, nil
+}
+
+// Logs returns the output log of a job.
+func (m *Manager) Logs(id string) (*Log, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    j, ok := m.jobs[id]
+    if !ok {
+        return nil, false
+    }
+    return j.log, true
+}
+
+// List returns snapshots of all known jobs, newest first.
+func (m *Manager) List() []Job {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.pruneLocked()
+    out := make([]Job, 0, len(m.jobs))
+    for _, j := range m.jobs {
+        out = append(out, *j)
+    }
+    sort.Slice(out, func(a, b int) bool { return out[a].CreatedAt.After(out[b].CreatedAt) })
+    return out
+}
+
+// Cancel stops a queued or running job.
+func (m *Manager) Cancel(id string) (Job, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    j, ok := m.jobs[id]
+    if !ok {
+        return Job{}, ErrNotFound
+    }
+    if j.Done() {
+        return *j, ErrFinished
+    }
+    if j.Status == StatusQueued {
+        now := time.Now().UTC()
+        j.Status = StatusCanceled
+        j.FinishedAt = &now
+    }
+    j.cancel()
+    return *j, nil
+}
+
+func (m *Manager) pruneLocked() {
+    if m.retention <= 0 {
+        return
+    }
+    cutoff := time.Now().Add(-m.retention)
+    for id, j := range m.jobs {
+        if j.FinishedAt != nil && j.FinishedAt.Before(cutoff) {
+            delete(m.jobs, id)
+        }
+    }
+}
+
+func newID() string {
+    var b [8]byte
+    _, _ = rand.Read(b[:])
+    return hex.EncodeToString(b[:])
+}
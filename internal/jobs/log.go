@@ -0,0 +1,113 @@
+package jobs
+
+import (
+    "bytes"
+    "sync"
+    "time"
+
+    "automation/api/internal/runner"
+)
+
+// maxLogLines bounds the lines kept per job; older lines are dropped first.
+const maxLogLines = 20000
+
+// Line is a single line of child output.
+type Line struct {
+    Seq    int       `json:"seq"`
+    Time   time.Time `json:"time"`
+    Stream string    `json:"stream"`
+    Type   string    `json:"type"`
+    Text   string    `json:"text"`
+}
+
+// Log collects the output of a job line by line and wakes up readers when
+// new lines arrive.
+type Log struct {
+    mu     sync.Mutex
+    lines  []Line
+    seq    int
+    closed bool
+    notify chan struct{}
+}
+
+func newLog() *Log {
+    return &Log{notify: make(chan struct{})}
+}
+
+func (l *Log) append(stream, text string) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.closed {
+        return
+    }
+    l.seq++
+    l.lines = append(l.lines, Line{
+        Seq:    l.seq,
+        Time:   time.Now().UTC(),
+        Stream: stream,
+        Type:   runner.LineType(text),
+        Text:   text,
+    })
+    if len(l.lines) > maxLogLines {
+        l.lines = l.lines[len(l.lines)-maxLogLines:]
+    }
+    close(l.notify)
+    l.notify = make(chan struct{})
+}
+
+func (l *Log) close() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.closed {
+        return
+    }
+    l.closed = true
+    close(l.notify)
+}
+
+// Since returns the lines after seq, a channel closed when more output is
+// available, and whether the log is complete.
+func (l *Log) Since(seq int) ([]Line, <-chan struct{}, bool) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    var out []Line
+    for i := range l.lines {
+        if l.lines[i].Seq > seq {
+            out = append(out, l.lines[i:]...)
+            break
+        }
+    }
+    return out, l.notify, l.closed
+}
+
+// lineWriter splits written bytes into lines and appends them to a Log.
+type lineWriter struct {
+    log    *Log
+    stream string
+    mu     sync.Mutex
+    buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    w.buf = append(w.buf, p...)
+    for {
+        i := bytes.IndexByte(w.buf, '\n')
+        if i == -1 {
+            break
+        }
+        w.log.append(w.stream, string(bytes.TrimRight(w.buf[:i], "\r")))
+        w.buf = w.buf[i+1:]
+    }
+    return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if len(w.buf) > 0 {
+        w.log.append(w.stream, string(w.buf))
+        w.buf = nil
+    }
+}
@@ -0,0 +1,200 @@
+package report
+
+import (
+    "encoding/json"
+    "encoding/xml"
+    "fmt"
+    "path/filepath"
+    "strings"
+
+    "automation/api/internal/history"
+    "automation/api/internal/runner"
+)
+
+// testResult is a test case with its failure details resolved.
+type testResult struct {
+    runner.TestCase
+    Message string
+    Details string
+    Stderr  string
+}
+
+// results resolves failure messages for every test of a run. Test scripts
+// print "[FAIL] <group>/<name>: reason" to stderr, which run.js passes
+// through unsplit, so stderr lines are matched to tests by that label; when
+// the run has a single test it owns the whole stderr. A failed run with no
+// parsed tests (node missing, no tests found) becomes one synthetic case.
+func results(run history.Run) []testResult {
+    tests := run.Tests
+    if len(tests) == 0 && !run.OK {
+        tests = []runner.TestCase{{
+            Name:       strings.TrimSpace(run.Command + " " + strings.Join(run.Args, " ")),
+            Group:      "run",
+            Status:     "fail",
+            DurationMs: run.DurationMs,
+        }}
+    }
+    stderrLines := strings.Split(run.Stderr, "\n")
+
+    out := make([]testResult, 0, len(tests))
+    for _, tc := range tests {
+        tr := testResult{TestCase: tc}
+        if len(tests) == 1 {
+            tr.Stderr = run.Stderr
+        }
+        if tc.Status != "pass" {
+            label := tc.Group + "/" + strings.TrimSuffix(tc.Name, filepath.Ext(tc.Name))
+            var fails []string
+            for _, ln := range strings.Split(tc.Output, "\n") {
+                if strings.HasPrefix(strings.TrimSpace(ln), "[FAIL]") {
+                    fails = append(fails, strings.TrimSpace(ln))
+                }
+            }
+            for _, ln := range stderrLines {
+                ln = strings.TrimSpace(ln)
+                if strings.HasPrefix(ln, "[FAIL]") && (len(tests) == 1 || strings.Contains(ln, label)) {
+                    fails = append(fails, ln)
+                }
+            }
+            switch {
+            case len(fails) > 0:
+                tr.Message = fails[0]
+            case tc.Status == "incomplete":
+                tr.Message = "test did not finish"
+            case run.Error != "":
+                tr.Message = run.Error
+            default:
+                tr.Message = "test failed"
+            }
+            tr.Details = strings.Join(fails, "\n")
+            if tr.Stderr != "" {
+                tr.Details = strings.TrimSpace(tr.Details + "\n" + tr.Stderr)
+            }
+        }
+        out = append(out, tr)
+    }
+    return out
+}
+
+type junitSuites struct {
+    XMLName  xml.Name     `xml:"testsuites"`
+    Name     string       `xml:"name,attr"`
+    Tests    int          `xml:"tests,attr"`
+    Failures int          `xml:"failures,attr"`
+    Errors   int          `xml:"errors,attr"`
+    Time     string       `xml:"time,attr"`
+    Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+    Name      string      `xml:"name,attr"`
+    Tests     int         `xml:"tests,attr"`
+    Failures  int         `xml:"failures,attr"`
+    Errors    int         `xml:"errors,attr"`
+    Time      string      `xml:"time,attr"`
+    Timestamp string      `xml:"timestamp,attr,omitempty"`
+    Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+    Name      string        `xml:"name,attr"`
+    Classname string        `xml:"classname,attr"`
+    Time      string        `xml:"time,attr"`
+    Failure   *junitProblem `xml:"failure,omitempty"`
+    Error     *junitProblem `xml:"error,omitempty"`
+    SystemOut string        `xml:"system-out,omitempty"`
+    SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitProblem struct {
+    Message string `xml:"message,attr"`
+    Type    string `xml:"type,attr"`
+    Body    string `xml:",chardata"`
+}
+
+// JUnit renders a run as JUnit XML with one testsuite per test group and
+// one testcase per Playwright script.
+func JUnit(run history.Run) ([]byte, error) {
+    doc := junitSuites{Name: fmt.Sprintf("run-%d", run.ID), Time: seconds(run.DurationMs)}
+    index := map[string]int{}
+    var suiteMs []int64
+    for _, tr := range results(run) {
+        i, ok := index[tr.Group]
+        if !ok {
+            i = len(doc.Suites)
+            index[tr.Group] = i
+            doc.Suites = append(doc.Suites, junitSuite{Name: tr.Group, Timestamp: run.StartedAt})
+            suiteMs = append(suiteMs, 0)
+        }
+        suiteMs[i] += tr.DurationMs
+        s := &doc.Suites[i]
+        c := junitCase{
+            Name:      tr.Name,
+            Classname: tr.Group,
+            Time:      seconds(tr.DurationMs),
+            SystemOut: tr.Output,
+            SystemErr: tr.Stderr,
+        }
+        switch tr.Status {
+        case "fail":
+            c.Failure = &junitProblem{Message: tr.Message, Type: "failure", Body: tr.Details}
+            s.Failures++
+            doc.Failures++
+        case "incomplete":
+            c.Error = &junitProblem{Message: tr.Message, Type: "incomplete", Body: tr.Details}
+            s.Errors++
+            doc.Errors++
+        }
+        s.Tests++
+        doc.Tests++
+        s.Cases = append(s.Cases, c)
+    }
+    for i := range doc.Suites {
+        doc.Suites[i].Time = seconds(suiteMs[i])
+    }
+
+    b, err := xml.MarshalIndent(doc, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// TAP renders a run as a TAP version 13 stream with a YAML diagnostic block
+// for every failing test.
+func TAP(run history.Run) string {
+    rs := results(run)
+    var b strings.Builder
+    b.WriteString("TAP version 13\n")
+    fmt.Fprintf(&b, "1..%d\n", len(rs))
+    for i, tr := range rs {
+        name := tr.Group + "/" + tr.Name
+        if tr.Status == "pass" {
+            fmt.Fprintf(&b, "ok %d - %s # time=%dms\n", i+1, name, tr.DurationMs)
+            continue
+        }
+        fmt.Fprintf(&b, "not ok %d - %s # time=%dms\n", i+1, name, tr.DurationMs)
+        b.WriteString("  ---\n")
+        fmt.Fprintf(&b, "  message: %s\n", yamlString(tr.Message))
+        fmt.Fprintf(&b, "  severity: %s\n", tr.Status)
+        fmt.Fprintf(&b, "  duration_ms: %d\n", tr.DurationMs)
+        if tr.Details != "" {
+            b.WriteString("  details: |\n")
+            for _, ln := range strings.Split(tr.Details, "\n") {
+                b.WriteString("    " + ln + "\n")
+            }
+        }
+        b.WriteString("  ...\n")
+    }
+    return b.String()
+}
+
+func seconds(ms int64) string {
+    return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// yamlString quotes s as a YAML double-quoted scalar (JSON strings are valid).
+func yamlString(s string) string {
+    b, _ := json.Marshal(s)
+    return string(b)
+}
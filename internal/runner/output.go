@@ -0,0 +1,105 @@
+package runner
+
+import (
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// linePrefixes maps the markers printed by run.js and the test scripts to
+// event types.
+var linePrefixes = []struct {
+    prefix string
+    kind   string
+}{
+    {"=== RUN", "run"},
+    {"--- PASS", "pass"},
+    {"--- FAIL", "fail"},
+    {"[STEP]", "step"},
+    {"[INFO]", "info"},
+    {"[DOWNLOAD]", "download"},
+    {"[PASS]", "pass"},
+    {"[FAIL]", "fail"},
+    {"[DEBUG]", "debug"},
+    {"[DONE]", "done"},
+    {"[RUN]", "run"},
+}
+
+// LineType classifies a line of test output by its marker prefix. Lines
+// without a known marker are "log".
+func LineType(line string) string {
+    line = strings.TrimSpace(line)
+    for _, p := range linePrefixes {
+        if strings.HasPrefix(line, p.prefix) {
+            return p.kind
+        }
+    }
+    return "log"
+}
+
+// TestCase is the outcome of one test file as reported by run.js.
+type TestCase struct {
+    Name       string `json:"name"`
+    Group      string `json:"group"`
+    File       string `json:"file"`
+    Status     string `json:"status"` // pass | fail | incomplete
+    DurationMs int64  `json:"durationMs"`
+    Output     string `json:"output"`
+}
+
+// ParseTests splits run.js stdout into per-test results using the
+// "=== RUN <file>" and "--- PASS|FAIL <file> (1.23s)" markers. A test with
+// no closing marker (e.g. the run was killed) is reported as incomplete.
+func ParseTests(stdout string) []TestCase {
+    var out []TestCase
+    var cur *TestCase
+    var buf []string
+    finish := func(status string, durationMs int64) {
+        cur.Status = status
+        cur.DurationMs = durationMs
+        cur.Output = strings.Join(buf, "\n")
+        out = append(out, *cur)
+        cur, buf = nil, nil
+    }
+
+    for _, ln := range strings.Split(stdout, "\n") {
+        trimmed := strings.TrimSpace(strings.TrimRight(ln, "\r"))
+        switch {
+        case strings.HasPrefix(trimmed, "=== RUN "):
+            if cur != nil {
+                finish("incomplete", 0)
+            }
+            file := strings.TrimSpace(strings.TrimPrefix(trimmed, "=== RUN "))
+            cur = &TestCase{
+                Name:  filepath.Base(file),
+                Group: filepath.Base(filepath.Dir(file)),
+                File:  file,
+            }
+        case cur != nil && (strings.HasPrefix(trimmed, "--- PASS ") || strings.HasPrefix(trimmed, "--- FAIL ")):
+            status := "pass"
+            if strings.HasPrefix(trimmed, "--- FAIL ") {
+                status = "fail"
+            }
+            finish(status, parseDurationSuffix(trimmed))
+        case cur != nil:
+            buf = append(buf, strings.TrimRight(ln, "\r"))
+        }
+    }
+    if cur != nil {
+        finish("incomplete", 0)
+    }
+    return out
+}
+
+// parseDurationSuffix reads a trailing "(1.23s)" from a result marker.
+func parseDurationSuffix(line string) int64 {
+    i := strings.LastIndex(line, " (")
+    if i == -1 || !strings.HasSuffix(line, "s)") {
+        return 0
+    }
+    d, err := time.ParseDuration(line[i+2 : len(line)-1])
+    if err != nil {
+        return 0
+    }
+    return d.Milliseconds()
+}
@@ -0,0 +1,223 @@
+package runner
+
+import (
+    "context"
+    "errors"
+    "math"
+    "sync"
+    "time"
+)
+
+var (
+    // ErrQueueFull is returned when all slots are busy and the queue is at capacity.
+    ErrQueueFull = errors.New("run queue is full")
+    // ErrQueueTimeout is returned when a run waited longer than the pool's
+    // maximum queue wait without getting a slot.
+    ErrQueueTimeout = errors.New("timed out waiting for a free run slot")
+)
+
+// Pool limits how many runs (and therefore browser instances) execute at
+// once. Runs beyond the limit wait in a FIFO queue of bounded length.
+type Pool struct {
+    mu       sync.Mutex
+    slots    int
+    maxQueue int
+    maxWait  time.Duration
+    running  int
+    waiters  []*waiter
+    avgMs    float64
+}
+
+type waiter struct {
+    ready    chan struct{}
+    onQueued func(position int)
+}
+
+// PoolStats is a snapshot of pool usage.
+type PoolStats struct {
+    Slots     int   `json:"slots"`
+    MaxQueue  int   `json:"maxQueue"`
+    Running   int   `json:"running"`
+    Queued    int   `json:"queued"`
+    AvgRunMs  int64 `json:"avgRunMs"`
+}
+
+// NewPool creates a pool with the given number of concurrent slots and queue
+// length. maxWait bounds how long a run may stay queued; zero means no limit.
+func NewPool(slots, maxQueue int, maxWait time.Duration) *Pool {
+    if slots < 1 {
+        slots = 1
+    }
+    if maxQueue < 0 {
+        maxQueue = 0
+    }
+    return &Pool{slots: slots, maxQueue: maxQueue, maxWait: maxWait}
+}
+
+var pool = NewPool(2, 10, 0)
+
+// SetPool replaces the pool used by Run. It must be called before any run starts.
+func SetPool(p *Pool) {
+    pool = p
+}
+
+// Stats reports usage of the pool used by Run.
+func Stats() PoolStats {
+    return pool.Stats()
+}
+
+// Full reports whether the pool used by Run would reject a new run.
+func Full() bool {
+    return pool.Full()
+}
+
+// RetryAfter estimates when the pool used by Run will have room again.
+func RetryAfter() time.Duration {
+    return pool.RetryAfter()
+}
+
+func (p *Pool) Stats() PoolStats {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return PoolStats{
+        Slots:    p.slots,
+        MaxQueue: p.maxQueue,
+        Running:  p.running,
+        Queued:   len(p.waiters),
+        AvgRunMs: int64(p.avgMs),
+    }
+}
+
+// Full reports whether a new run would be rejected right now.
+func (p *Pool) Full() bool {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return p.running >= p.slots && len(p.waiters) >= p.maxQueue
+}
+
+// RetryAfter estimates how long until a queued run would start, based on
+// the average run duration. It is at least 5 seconds.
+func (p *Pool) RetryAfter() time.Duration {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    avg := p.avgMs
+    if avg == 0 {
+        avg = float64(time.Minute.Milliseconds())
+    }
+    rounds := math.Ceil(float64(len(p.waiters)+1) / float64(p.slots))
+    d := time.Duration(avg*rounds) * time.Millisecond
+    if d < 5*time.Second {
+        d = 5 * time.Second
+    }
+    return d
+}
+
+// Acquire waits for a free slot. onQueued, if set, is called with the
+// 1-based queue position whenever it changes while waiting. The returned
+// function must be called to free the slot.
+func (p *Pool) Acquire(ctx context.Context, onQueued func(position int)) (func(), error) {
+    p.mu.Lock()
+    if p.running < p.slots && len(p.waiters) == 0 {
+        p.running++
+        p.mu.Unlock()
+        return p.releaser(), nil
+    }
+    if len(p.waiters) >= p.maxQueue {
+        p.mu.Unlock()
+        return nil, ErrQueueFull
+    }
+    w := &waiter{ready: make(chan struct{}), onQueued: onQueued}
+    p.waiters = append(p.waiters, w)
+    pos := len(p.waiters)
+    p.mu.Unlock()
+    if onQueued != nil {
+        onQueued(pos)
+    }
+
+    var timeout <-chan time.Time
+    if p.maxWait > 0 {
+        t := time.NewTimer(p.maxWait)
+        defer t.Stop()
+        timeout = t.C
+    }
+    var err error
+    select {
+    case <-w.ready:
+        return p.releaser(), nil
+    case <-ctx.Done():
+        err = ctx.Err()
+    case <-timeout:
+        err = ErrQueueTimeout
+    }
+
+    p.mu.Lock()
+    select {
+    case <-w.ready:
+        // granted while we were giving up; hand the slot on without
+        // counting it as a run in the average
+        notify := p.handOffLocked()
+        p.mu.Unlock()
+        notify()
+        return nil, err
+    default:
+    }
+    for i, other := range p.waiters {
+        if other == w {
+            p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+            break
+        }
+    }
+    notify := p.positionsLocked()
+    p.mu.Unlock()
+    notify()
+    return nil, err
+}
+
+func (p *Pool) releaser() func() {
+    start := time.Now()
+    var once sync.Once
+    return func() {
+        once.Do(func() { p.release(time.Since(start)) })
+    }
+}
+
+func (p *Pool) release(elapsed time.Duration) {
+    p.mu.Lock()
+    // exponential moving average of run duration for Retry-After estimates
+    ms := float64(elapsed.Milliseconds())
+    if p.avgMs == 0 {
+        p.avgMs = ms
+    } else {
+        p.avgMs = 0.8*p.avgMs + 0.2*ms
+    }
+    notify := p.handOffLocked()
+    p.mu.Unlock()
+    notify()
+}
+
+// handOffLocked frees a slot, handing it directly to the head of the queue
+// if anyone is waiting. The returned function reports the new queue
+// positions and must be called outside the lock.
+func (p *Pool) handOffLocked() func() {
+    if len(p.waiters) == 0 {
+        p.running--
+        return func() {}
+    }
+    next := p.waiters[0]
+    p.waiters = p.waiters[1:]
+    close(next.ready)
+    return p.positionsLocked()
+}
+
+// positionsLocked captures the current queue positions and returns a
+// function that reports them outside the lock.
+func (p *Pool) positionsLocked() func() {
+    ws := append([]*waiter(nil), p.waiters...)
+    return func() {
+        for i, w := range ws {
+            if w.onQueued != nil {
+                w.onQueued(i + 1)
+            }
+        }
+    }
+}
@@ -0,0 +1,160 @@
+package runner
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestPoolAcquire(t *testing.T) {
+    tests := []struct {
+        name     string
+        slots    int
+        maxQueue int
+        held     int // slots taken before the acquire under test
+        wantErr  error
+    }{
+        {name: "free slot", slots: 2, maxQueue: 0, held: 1},
+        {name: "queue full", slots: 1, maxQueue: 0, held: 1, wantErr: ErrQueueFull},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            p := NewPool(tt.slots, tt.maxQueue, 0)
+            for i := 0; i < tt.held; i++ {
+                if _, err := p.Acquire(context.Background(), nil); err != nil {
+                    t.Fatalf("setup acquire: %v", err)
+                }
+            }
+            release, err := p.Acquire(context.Background(), nil)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("err = %v, want %v", err, tt.wantErr)
+            }
+            if err == nil {
+                release()
+            }
+        })
+    }
+}
+
+func TestPoolHandOff(t *testing.T) {
+    p := NewPool(1, 2, 0)
+    release, err := p.Acquire(context.Background(), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    positions := make(chan int, 4)
+    got := make(chan func(), 1)
+    go func() {
+        r, err := p.Acquire(context.Background(), func(pos int) { positions <- pos })
+        if err != nil {
+            t.Error(err)
+        }
+        got <- r
+    }()
+    if pos := <-positions; pos != 1 {
+        t.Fatalf("queue position = %d, want 1", pos)
+    }
+    release()
+    r := <-got
+    if s := p.Stats(); s.Running != 1 || s.Queued != 0 {
+        t.Fatalf("stats after hand-off = %+v, want 1 running, 0 queued", s)
+    }
+    r()
+    if s := p.Stats(); s.Running != 0 {
+        t.Fatalf("running after release = %d, want 0", s.Running)
+    }
+}
+
+func TestPoolWaitTimeout(t *testing.T) {
+    tests := []struct {
+        name    string
+        maxWait time.Duration
+        cancel  bool
+        wantErr error
+    }{
+        {name: "max wait", maxWait: 20 * time.Millisecond, wantErr: ErrQueueTimeout},
+        {name: "canceled", cancel: true, wantErr: context.Canceled},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            p := NewPool(1, 1, tt.maxWait)
+            release, err := p.Acquire(context.Background(), nil)
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer release()
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+            if tt.cancel {
+                go func() {
+                    time.Sleep(20 * time.Millisecond)
+                    cancel()
+                }()
+            }
+            if _, err := p.Acquire(ctx, nil); !errors.Is(err, tt.wantErr) {
+                t.Fatalf("err = %v, want %v", err, tt.wantErr)
+            }
+            if s := p.Stats(); s.Queued != 0 || s.Running != 1 {
+                t.Fatalf("stats = %+v, want 1 running, 0 queued", s)
+            }
+        })
+    }
+}
+
+// A slot granted to a waiter that is giving up goes to the next waiter
+// without touching the run-time average.
+func TestPoolAbandonedGrantKeepsAverage(t *testing.T) {
+    p := NewPool(1, 2, 0)
+    p.avgMs = 60000
+    p.running = 1
+    w := &waiter{ready: make(chan struct{})}
+    next := &waiter{ready: make(chan struct{})}
+    p.waiters = []*waiter{w, next}
+
+    // w is granted the slot, then gives up before noticing
+    p.mu.Lock()
+    p.waiters = p.waiters[1:]
+    close(w.ready)
+    notify := p.handOffLocked()
+    p.mu.Unlock()
+    notify()
+
+    select {
+    case <-next.ready:
+    default:
+        t.Fatal("next waiter was not handed the slot")
+    }
+    if p.avgMs != 60000 {
+        t.Fatalf("avgMs = %v, want 60000", p.avgMs)
+    }
+    if p.running != 1 {
+        t.Fatalf("running = %d, want 1", p.running)
+    }
+}
+
+func TestPoolRetryAfter(t *testing.T) {
+    tests := []struct {
+        name   string
+        avgMs  float64
+        queued int
+        slots  int
+        want   time.Duration
+    }{
+        {name: "no history", slots: 1, want: time.Minute},
+        {name: "floor", avgMs: 100, slots: 1, want: 5 * time.Second},
+        {name: "rounds", avgMs: 10000, queued: 3, slots: 2, want: 20 * time.Second},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            p := NewPool(tt.slots, 10, 0)
+            p.avgMs = tt.avgMs
+            for i := 0; i < tt.queued; i++ {
+                p.waiters = append(p.waiters, &waiter{ready: make(chan struct{})})
+            }
+            if got := p.RetryAfter(); got != tt.want {
+                t.Fatalf("RetryAfter = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package runner
+
+import (
+    "os/exec"
+    "syscall"
+)
+
+// killProcessGroup starts the command in its own process group and makes
+// context cancellation kill the whole group, so Chromium instances spawned by
+// run.js children do not outlive the run.
+func killProcessGroup(c *exec.Cmd) {
+    c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+    c.Cancel = func() error {
+        if c.Process == nil {
+            return nil
+        }
+        return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+    }
+}
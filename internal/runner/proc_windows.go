@@ -0,0 +1,9 @@
+//go:build windows
+
+package runner
+
+import "os/exec"
+
+// killProcessGroup is a no-op on Windows; exec.CommandContext kills the
+// direct child only.
+func killProcessGroup(c *exec.Cmd) {}
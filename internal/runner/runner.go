@@ -18,6 +18,7 @@ type TestIndex struct {
 }
 
 type ExecResult struct {
+    RunID     int64  `json:"runId,omitempty"`
     OK        bool   `json:"ok"`
     Command   string `json:"command"`
     Args      []string `json:"args"`
@@ -26,6 +27,25 @@ type ExecResult struct {
     Stdout    string `json:"stdout"`
     Stderr    string `json:"stderr"`
     Error     string `json:"error,omitempty"`
+    StartedAt time.Time `json:"startedAt"`
+    Tests     []TestCase `json:"tests,omitempty"`
+
+    err error
+}
+
+// Err returns the error that prevented the run from starting, such as
+// ErrQueueFull, or nil if the process was started.
+func (r ExecResult) Err() error {
+    return r.err
+}
+
+var recorder func(ExecResult) int64
+
+// SetRecorder installs a hook called with every finished run. The returned
+// ID is stored in ExecResult.RunID; zero means the run was not recorded.
+// It must be called before any run starts.
+func SetRecorder(fn func(ExecResult) int64) {
+    recorder = fn
 }
 
 func ListTests(root string) (TestIndex, error) {
@@ -59,18 +79,73 @@ func ListTests(root string) (TestIndex, error) {
     return idx, nil
 }
 
+// Command describes a single run.js invocation relative to the automation root.
+type Command struct {
+    Args []string
+    Env  map[string]string
+    // Stdout and Stderr, when set, receive child output as it is produced
+    // in addition to the captured buffers.
+    Stdout io.Writer
+    Stderr io.Writer
+    // OnQueued is called with the queue position while the run waits for a
+    // free slot; OnStart is called once the run gets a slot.
+    OnQueued func(position int)
+    OnStart  func()
+}
+
+// AllCommand runs every test under tests/.
+func AllCommand() Command {
+    return Command{Args: []string{"node", "run.js"}}
+}
+
+// GroupCommand runs every test in tests/<group>.
+func GroupCommand(group string) Command {
+    return Command{Args: []string{"node", "run.js", filepath.Join("tests", group)}}
+}
+
+// TestCommand runs a single test file tests/<group>/<test>.
+func TestCommand(group, test string) Command {
+    return Command{Args: []string{"node", "run.js", filepath.Join("tests", group, test)}}
+}
+
+// BateoExportCommand runs the bateo flow for a specific date (YYYY-MM-DD).
+// When rangeStart and rangeEnd are set they are passed as RANGE_START and
+// RANGE_END and take precedence over the range derived from the date.
+func BateoExportCommand(baseURL, user, pass, dateStr, rangeStart, rangeEnd string) Command {
+    c := Command{
+        Args: []string{"node", "run.js", filepath.Join("tests", "bateo", "fecha_rango.js")},
+        Env: map[string]string{
+            "ERP_BASE_URL": baseURL,
+            "ERP_USER":     user,
+            "ERP_PASS":     pass,
+            "QUERY_DATE":   dateStr,
+            // default to headless for server mode
+            "HEADLESS":     "1",
+        },
+    }
+    if rangeStart != "" && rangeEnd != "" {
+        c.Env["RANGE_START"] = rangeStart
+        c.Env["RANGE_END"] = rangeEnd
+    }
+    return c
+}
+
+// Run executes c under playRoot. Cancelling ctx kills the node process and
+// any browser it spawned.
+func Run(ctx context.Context, playRoot string, c Command) ExecResult {
+    return runWithEnv(ctx, playRoot, c)
+}
+
 func RunAll(playRoot string) ExecResult {
-    return runWithEnv(playRoot, []string{"node", "run.js"}, nil)
+    return Run(context.Background(), playRoot, AllCommand())
 }
 
 func RunGroup(playRoot, group string) ExecResult {
-    path := filepath.Join("tests", group)
-    return runWithEnv(playRoot, []string{"node", "run.js", path}, nil)
+    return Run(context.Background(), playRoot, GroupCommand(group))
 }
 
 func RunTest(playRoot, group, test string) ExecResult {
-    path := filepath.Join("tests", group, test)
-    return runWithEnv(playRoot, []string{"node", "run.js", path}, nil)
+    return Run(context.Background(), playRoot, TestCommand(group, test))
 }
 
 // RunBateoFechaRange sets ERP_* env vars and runs the composed flow test.
@@ -83,25 +158,38 @@ func RunBateoFechaRange(playRoot, baseURL, user, pass string) ExecResult {
         // default to headless for server mode
         "HEADLESS":     "1",
     }
-    return runWithEnv(playRoot, args, env)
+    return runWithEnv(context.Background(), playRoot, Command{Args: args, Env: env})
 }
 
-// RunBateoExportForDate runs the bateo flow for a specific date (YYYY-MM-DD).
-// The effective range is: start = first day of that month, end = given date + 1 day.
+// RunBateoExportForDate runs the bateo flow for a specific date (YYYY-MM-DD)
+// without an explicit range, so the flow falls back to its own month-to-date
+// computation. The server goes through the bateo package instead, which
+// always passes RANGE_START/RANGE_END.
 func RunBateoExportForDate(playRoot, baseURL, user, pass, dateStr string) ExecResult {
-    args := []string{"node", "run.js", filepath.Join("tests", "bateo", "fecha_rango.js")}
-    env := map[string]string{
-        "ERP_BASE_URL": baseURL,
-        "ERP_USER":     user,
-        "ERP_PASS":     pass,
-        "QUERY_DATE":   dateStr,
-        // default to headless for server mode
-        "HEADLESS":     "1",
-    }
-    return runWithEnv(playRoot, args, env)
+    return Run(context.Background(), playRoot, BateoExportCommand(baseURL, user, pass, dateStr, "", ""))
 }
 
-func runWithEnv(playRoot string, args []string, extraEnv map[string]string) ExecResult {
+func runWithEnv(parent context.Context, playRoot string, c Command) ExecResult {
+    args, extraEnv := c.Args, c.Env
+    release, err := pool.Acquire(parent, c.OnQueued)
+    if err != nil {
+        msg := err.Error()
+        if errors.Is(err, context.Canceled) {
+            msg = "canceled"
+        }
+        return ExecResult{
+            Command:  args[0],
+            Args:     args[1:],
+            ExitCode: -1,
+            Error:    msg,
+            err:      err,
+        }
+    }
+    defer release()
+    if c.OnStart != nil {
+        c.OnStart()
+    }
+
     start := time.Now()
     // Resolve playRoot to an absolute directory
     dir := resolvePlayRoot(playRoot)
@@ -120,17 +208,25 @@ func runWithEnv(playRoot string, args []string, extraEnv map[string]string) Exec
     var outBuf, errBuf bytes.Buffer
     // Mirror child output to server stdout/stderr for live visibility,
     // while still capturing buffers for API responses.
-    cmd.Stdout = io.MultiWriter(&outBuf, os.Stdout)
-    cmd.Stderr = io.MultiWriter(&errBuf, os.Stderr)
+    stdout := []io.Writer{&outBuf, os.Stdout}
+    stderr := []io.Writer{&errBuf, os.Stderr}
+    if c.Stdout != nil {
+        stdout = append(stdout, c.Stdout)
+    }
+    if c.Stderr != nil {
+        stderr = append(stderr, c.Stderr)
+    }
+    cmd.Stdout = io.MultiWriter(stdout...)
+    cmd.Stderr = io.MultiWriter(stderr...)
 
     // Add a generous timeout
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+    ctx, cancel := context.WithTimeout(parent, 10*time.Minute)
     defer cancel()
 
     cmd = commandWithContext(ctx, cmd)
 
     exitCode := 0
-    err := cmd.Run()
+    err = cmd.Run()
     if err != nil {
         if exitErr, ok := err.(*exec.ExitError); ok {
             exitCode = exitErr.ExitCode()
@@ -147,13 +243,23 @@ func runWithEnv(playRoot string, args []string, extraEnv map[string]string) Exec
         DurationMs: time.Since(start).Milliseconds(),
         Stdout:     outBuf.String(),
         Stderr:     errBuf.String(),
+        StartedAt:  start.UTC(),
+        Tests:      ParseTests(outBuf.String()),
     }
     if err != nil {
         res.Error = err.Error()
+        if errors.Is(parent.Err(), context.Canceled) {
+            res.Error = "canceled"
+        } else if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+            res.Error = "timed out"
+        }
         if errors.Is(err, exec.ErrNotFound) {
             res.Error = fmt.Sprintf("%s (ensure Node.js is installed)", res.Error)
         }
     }
+    if recorder != nil {
+        res.RunID = recorder(res)
+    }
     return res
 }
 
@@ -166,6 +272,7 @@ func commandWithContext(ctx context.Context, base *exec.Cmd) *exec.Cmd {
     c.Stdout = base.Stdout
     c.Stderr = base.Stderr
     c.Stdin = base.Stdin
+    killProcessGroup(c)
     return c
 }
 
@@ -0,0 +1,149 @@
+package schedule
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// cronSpec is a parsed 5-field cron expression: minute hour day-of-month
+// month day-of-week. Each field is a bit set of allowed values.
+type cronSpec struct {
+    minute, hour, dom, month, dow uint64
+    domAny, dowAny                bool
+}
+
+var cronDescriptors = map[string]string{
+    "@hourly":  "0 * * * *",
+    "@daily":   "0 0 * * *",
+    "@midnight": "0 0 * * *",
+    "@weekly":  "0 0 * * 0",
+    "@monthly": "0 0 1 * *",
+    "@yearly":  "0 0 1 1 *",
+    "@annually": "0 0 1 1 *",
+}
+
+// parseCron parses expressions such as "0 7 * * *", "*/15 8-20 * * 1-5"
+// or "@daily". Lists, ranges and steps are supported; day-of-week accepts
+// 0-7 with both 0 and 7 meaning Sunday.
+func parseCron(expr string) (cronSpec, error) {
+    var c cronSpec
+    expr = strings.TrimSpace(expr)
+    if d, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+        expr = d
+    }
+    fields := strings.Fields(expr)
+    if len(fields) != 5 {
+        return c, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+    }
+    var err error
+    if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+        return c, fmt.Errorf("cron minute: %w", err)
+    }
+    if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+        return c, fmt.Errorf("cron hour: %w", err)
+    }
+    if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+        return c, fmt.Errorf("cron day of month: %w", err)
+    }
+    if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+        return c, fmt.Errorf("cron month: %w", err)
+    }
+    if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+        return c, fmt.Errorf("cron day of week: %w", err)
+    }
+    if c.dow&(1<<7) != 0 {
+        c.dow |= 1
+    }
+    c.domAny = fields[2] == "*"
+    c.dowAny = fields[4] == "*"
+    return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+    var set uint64
+    for _, part := range strings.Split(field, ",") {
+        step := 1
+        if i := strings.Index(part, "/"); i != -1 {
+            n, err := strconv.Atoi(part[i+1:])
+            if err != nil || n < 1 {
+                return 0, fmt.Errorf("invalid step in %q", part)
+            }
+            step = n
+            part = part[:i]
+        }
+        lo, hi := min, max
+        switch {
+        case part == "*":
+        case strings.Contains(part, "-"):
+            bounds := strings.SplitN(part, "-", 2)
+            a, err1 := strconv.Atoi(bounds[0])
+            b, err2 := strconv.Atoi(bounds[1])
+            if err1 != nil || err2 != nil || a > b {
+                return 0, fmt.Errorf("invalid range %q", part)
+            }
+            lo, hi = a, b
+        default:
+            n, err := strconv.Atoi(part)
+            if err != nil {
+                return 0, fmt.Errorf("invalid value %q", part)
+            }
+            lo = n
+            if step == 1 {
+                hi = n
+            }
+        }
+        if lo < min || hi > max {
+            return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+        }
+        for v := lo; v <= hi; v += step {
+            set |= 1 << uint(v)
+        }
+    }
+    return set, nil
+}
+
+func (c cronSpec) dayMatches(t time.Time) bool {
+    domOK := c.dom&(1<<uint(t.Day())) != 0
+    dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+    // classic cron: when both fields are restricted either may match
+    switch {
+    case c.domAny && c.dowAny:
+        return true
+    case c.domAny:
+        return dowOK
+    case c.dowAny:
+        return domOK
+    default:
+        return domOK || dowOK
+    }
+}
+
+// next returns the first time strictly after t matching the expression in
+// t's location, or the zero time if none is found within five years.
+func (c cronSpec) next(t time.Time) time.Time {
+    loc := t.Location()
+    t = t.Truncate(time.Minute).Add(time.Minute)
+    limit := t.AddDate(5, 0, 0)
+    for t.Before(limit) {
+        if c.month&(1<<uint(t.Month())) == 0 {
+            t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+            continue
+        }
+        if !c.dayMatches(t) {
+            t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+            continue
+        }
+        if c.hour&(1<<uint(t.Hour())) == 0 {
+            t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+            continue
+        }
+        if c.minute&(1<<uint(t.Minute())) == 0 {
+            t = t.Add(time.Minute)
+            continue
+        }
+        return t
+    }
+    return time.Time{}
+}
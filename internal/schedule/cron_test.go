@@ -0,0 +1,71 @@
+package schedule
+
+import (
+    "testing"
+    "time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        expr string
+    }{
+        {name: "too few fields", expr: "0 7 * *"},
+        {name: "too many fields", expr: "0 7 * * * *"},
+        {name: "minute out of range", expr: "60 * * * *"},
+        {name: "hour out of range", expr: "0 24 * * *"},
+        {name: "day of month zero", expr: "0 0 0 * *"},
+        {name: "month out of range", expr: "0 0 1 13 *"},
+        {name: "day of week out of range", expr: "0 0 * * 8"},
+        {name: "reversed range", expr: "0 20-8 * * *"},
+        {name: "zero step", expr: "*/0 * * * *"},
+        {name: "not a number", expr: "x * * * *"},
+        {name: "unknown descriptor", expr: "@sometimes"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := parseCron(tt.expr); err == nil {
+                t.Fatalf("parseCron(%q) succeeded, want error", tt.expr)
+            }
+        })
+    }
+}
+
+func TestCronNext(t *testing.T) {
+    // 2024-03-13 is a Wednesday
+    base := time.Date(2024, 3, 13, 10, 17, 30, 0, time.UTC)
+    tests := []struct {
+        name string
+        expr string
+        from time.Time
+        want time.Time
+    }{
+        {name: "daily at 7 tomorrow", expr: "0 7 * * *", from: base, want: time.Date(2024, 3, 14, 7, 0, 0, 0, time.UTC)},
+        {name: "daily at 7 later today", expr: "0 7 * * *", from: time.Date(2024, 3, 13, 6, 59, 0, 0, time.UTC), want: time.Date(2024, 3, 13, 7, 0, 0, 0, time.UTC)},
+        {name: "strictly after", expr: "0 7 * * *", from: time.Date(2024, 3, 13, 7, 0, 0, 0, time.UTC), want: time.Date(2024, 3, 14, 7, 0, 0, 0, time.UTC)},
+        {name: "every 15 minutes", expr: "*/15 * * * *", from: base, want: time.Date(2024, 3, 13, 10, 30, 0, 0, time.UTC)},
+        {name: "step from value", expr: "5/20 * * * *", from: base, want: time.Date(2024, 3, 13, 10, 25, 0, 0, time.UTC)},
+        {name: "list", expr: "0 9,12,18 * * *", from: base, want: time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)},
+        {name: "weekdays skip weekend", expr: "0 8 * * 1-5", from: time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC), want: time.Date(2024, 3, 18, 8, 0, 0, 0, time.UTC)},
+        {name: "sunday as 7", expr: "0 0 * * 7", from: base, want: time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+        {name: "sunday as 0", expr: "0 0 * * 0", from: base, want: time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+        {name: "monthly", expr: "@monthly", from: base, want: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+        {name: "yearly", expr: "@yearly", from: base, want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+        {name: "leap day", expr: "0 0 29 2 *", from: base, want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+        // day of month and day of week both restricted: either matches
+        {name: "dom or dow", expr: "0 0 20 * 5", from: base, want: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+        {name: "never", expr: "0 0 31 2 *", from: base, want: time.Time{}},
+        {name: "keeps location", expr: "0 7 * * *", from: time.Date(2024, 3, 13, 8, 0, 0, 0, time.FixedZone("CST", -6*3600)), want: time.Date(2024, 3, 14, 7, 0, 0, 0, time.FixedZone("CST", -6*3600))},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            c, err := parseCron(tt.expr)
+            if err != nil {
+                t.Fatalf("parseCron(%q): %v", tt.expr, err)
+            }
+            if got := c.next(tt.from); !got.Equal(tt.want) {
+                t.Fatalf("next(%s) = %s, want %s", tt.from, got, tt.want)
+            }
+        })
+    }
+}
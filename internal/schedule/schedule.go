@@ -0,0 +1,423 @@
+package schedule
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+    _ "time/tzdata"
+
+    _ "modernc.org/sqlite"
+)
+
+// DefaultTimezone is used when a schedule does not name one.
+const DefaultTimezone = "America/Mexico_City"
+
+var ErrNotFound = errors.New("schedule not found")
+
+// Schedule fires Target (a job description, see POST /jobs) either on a
+// cron expression evaluated in Timezone or at a fixed interval (Every, a Go
+// duration such as "30m").
+type Schedule struct {
+    ID         int64           `json:"id"`
+    Name       string          `json:"name"`
+    Cron       string          `json:"cron,omitempty"`
+    Every      string          `json:"every,omitempty"`
+    Timezone   string          `json:"timezone"`
+    Target     json.RawMessage `json:"target"`
+    Enabled    bool            `json:"enabled"`
+    NextRunAt  string          `json:"nextRunAt,omitempty"`
+    LastRunAt  string          `json:"lastRunAt,omitempty"`
+    LastStatus string          `json:"lastStatus,omitempty"`
+    CreatedAt  string          `json:"createdAt"`
+    UpdatedAt  string          `json:"updatedAt"`
+}
+
+// Outcome is the result of firing a schedule once.
+type Outcome struct {
+    JobID string `json:"jobId,omitempty"`
+    RunID int64  `json:"runId,omitempty"`
+    OK    bool   `json:"ok"`
+    Error string `json:"error,omitempty"`
+}
+
+// Firing is one recorded execution of a schedule.
+type Firing struct {
+    ID         int64  `json:"id"`
+    ScheduleID int64  `json:"scheduleId"`
+    FiredAt    string `json:"firedAt"`
+    FinishedAt string `json:"finishedAt"`
+    Outcome
+}
+
+// validate checks the timing fields and returns the schedule's location.
+func (s *Schedule) validate() (*time.Location, error) {
+    s.Name = strings.TrimSpace(s.Name)
+    if s.Name == "" {
+        return nil, errors.New("name is required")
+    }
+    if (s.Cron == "") == (s.Every == "") {
+        return nil, errors.New("exactly one of cron or every is required")
+    }
+    if s.Cron != "" {
+        if _, err := parseCron(s.Cron); err != nil {
+            return nil, err
+        }
+    } else {
+        d, err := time.ParseDuration(s.Every)
+        if err != nil {
+            return nil, fmt.Errorf("every: %w", err)
+        }
+        if d < time.Minute {
+            return nil, errors.New("every must be at least 1m")
+        }
+    }
+    if s.Timezone == "" {
+        s.Timezone = DefaultTimezone
+    }
+    loc, err := time.LoadLocation(s.Timezone)
+    if err != nil {
+        return nil, fmt.Errorf("timezone: %w", err)
+    }
+    if len(s.Target) == 0 {
+        return nil, errors.New("target is required")
+    }
+    return loc, nil
+}
+
+// nextAfter returns the next firing strictly after t.
+func (s Schedule) nextAfter(t time.Time) time.Time {
+    if s.Every != "" {
+        d, _ := time.ParseDuration(s.Every)
+        return t.Add(d)
+    }
+    loc, err := time.LoadLocation(s.Timezone)
+    if err != nil {
+        loc = time.UTC
+    }
+    c, err := parseCron(s.Cron)
+    if err != nil {
+        return time.Time{}
+    }
+    return c.next(t.In(loc))
+}
+
+func openDB(dbPath string) (*sql.DB, error) {
+    if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+        return nil, err
+    }
+    return sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
+}
+
+func initSchema(db *sql.DB) error {
+    stmts := []string{
+        `CREATE TABLE IF NOT EXISTS schedules (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name        TEXT NOT NULL,
+            cron        TEXT NOT NULL DEFAULT '',
+            every       TEXT NOT NULL DEFAULT '',
+            timezone    TEXT NOT NULL,
+            target_json TEXT NOT NULL,
+            enabled     INTEGER NOT NULL DEFAULT 1,
+            next_run_at TEXT NOT NULL DEFAULT '',
+            last_run_at TEXT NOT NULL DEFAULT '',
+            last_status TEXT NOT NULL DEFAULT '',
+            created_at  TEXT NOT NULL,
+            updated_at  TEXT NOT NULL
+        );`,
+        `CREATE TABLE IF NOT EXISTS schedule_runs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            schedule_id INTEGER NOT NULL,
+            fired_at    TEXT NOT NULL,
+            finished_at TEXT NOT NULL,
+            job_id      TEXT NOT NULL DEFAULT '',
+            run_id      INTEGER,
+            ok          INTEGER NOT NULL,
+            error       TEXT NOT NULL DEFAULT '',
+            FOREIGN KEY(schedule_id) REFERENCES schedules(id) ON DELETE CASCADE
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule ON schedule_runs(schedule_id);`,
+    }
+    for _, s := range stmts {
+        if _, err := db.Exec(s); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func withDB(dbPath string, fn func(db *sql.DB) error) error {
+    db, err := openDB(dbPath)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+    if err := initSchema(db); err != nil {
+        return err
+    }
+    return fn(db)
+}
+
+const scheduleCols = `id, name, cron, every, timezone, target_json, enabled, next_run_at, last_run_at, last_status, created_at, updated_at`
+
+func scanSchedule(row interface{ Scan(...any) error }) (Schedule, error) {
+    var s Schedule
+    var target string
+    err := row.Scan(&s.ID, &s.Name, &s.Cron, &s.Every, &s.Timezone, &target, &s.Enabled, &s.NextRunAt, &s.LastRunAt, &s.LastStatus, &s.CreatedAt, &s.UpdatedAt)
+    s.Target = json.RawMessage(target)
+    return s, err
+}
+
+// List returns all schedules ordered by ID.
+func List(dbPath string) ([]Schedule, error) {
+    out := []Schedule{}
+    err := withDB(dbPath, func(db *sql.DB) error {
+        rows, err := db.Query(`SELECT ` + scheduleCols + ` FROM schedules ORDER BY id`)
+        if err != nil {
+            return err
+        }
+        defer rows.Close()
+        for rows.Next() {
+            s, err := scanSchedule(rows)
+            if err != nil {
+                return err
+            }
+            out = append(out, s)
+        }
+        return rows.Err()
+    })
+    return out, err
+}
+
+// Get returns a schedule by ID.
+func Get(dbPath string, id int64) (Schedule, error) {
+    var s Schedule
+    err := withDB(dbPath, func(db *sql.DB) error {
+        var err error
+        s, err = scanSchedule(db.QueryRow(`SELECT `+scheduleCols+` FROM schedules WHERE id = ?`, id))
+        if errors.Is(err, sql.ErrNoRows) {
+            return ErrNotFound
+        }
+        return err
+    })
+    return s, err
+}
+
+// Create validates and stores a new schedule, computing its first firing.
+func Create(dbPath string, s Schedule) (Schedule, error) {
+    if _, err := s.validate(); err != nil {
+        return s, err
+    }
+    now := time.Now().UTC()
+    s.CreatedAt = now.Format(time.RFC3339)
+    s.UpdatedAt = s.CreatedAt
+    s.NextRunAt = formatTime(s.nextAfter(now))
+    err := withDB(dbPath, func(db *sql.DB) error {
+        res, err := db.Exec(`INSERT INTO schedules(name, cron, every, timezone, target_json, enabled, next_run_at, created_at, updated_at) VALUES(?,?,?,?,?,?,?,?,?)`,
+            s.Name, s.Cron, s.Every, s.Timezone, string(s.Target), s.Enabled, s.NextRunAt, s.CreatedAt, s.UpdatedAt)
+        if err != nil {
+            return err
+        }
+        s.ID, err = res.LastInsertId()
+        return err
+    })
+    return s, err
+}
+
+// Update replaces the definition of schedule s.ID and recomputes its next firing.
+func Update(dbPath string, s Schedule) (Schedule, error) {
+    if _, err := s.validate(); err != nil {
+        return s, err
+    }
+    cur, err := Get(dbPath, s.ID)
+    if err != nil {
+        return s, err
+    }
+    now := time.Now().UTC()
+    s.CreatedAt, s.LastRunAt, s.LastStatus = cur.CreatedAt, cur.LastRunAt, cur.LastStatus
+    s.UpdatedAt = now.Format(time.RFC3339)
+    s.NextRunAt = formatTime(s.nextAfter(now))
+    err = withDB(dbPath, func(db *sql.DB) error {
+        _, err := db.Exec(`UPDATE schedules SET name = ?, cron = ?, every = ?, timezone = ?, target_json = ?, enabled = ?, next_run_at = ?, updated_at = ? WHERE id = ?`,
+            s.Name, s.Cron, s.Every, s.Timezone, string(s.Target), s.Enabled, s.NextRunAt, s.UpdatedAt, s.ID)
+        return err
+    })
+    return s, err
+}
+
+// Delete removes a schedule and its firing history.
+func Delete(dbPath string, id int64) error {
+    return withDB(dbPath, func(db *sql.DB) error {
+        res, err := db.Exec(`DELETE FROM schedules WHERE id = ?`, id)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            return ErrNotFound
+        }
+        _, err = db.Exec(`DELETE FROM schedule_runs WHERE schedule_id = ?`, id)
+        return err
+    })
+}
+
+// Firings returns the most recent executions of a schedule, newest first.
+func Firings(dbPath string, id int64, limit int) ([]Firing, error) {
+    if limit <= 0 || limit > 500 {
+        limit = 50
+    }
+    out := []Firing{}
+    err := withDB(dbPath, func(db *sql.DB) error {
+        rows, err := db.Query(`SELECT id, schedule_id, fired_at, finished_at, job_id, run_id, ok, error FROM schedule_runs WHERE schedule_id = ? ORDER BY id DESC LIMIT ?`, id, limit)
+        if err != nil {
+            return err
+        }
+        defer rows.Close()
+        for rows.Next() {
+            var f Firing
+            var runID sql.NullInt64
+            if err := rows.Scan(&f.ID, &f.ScheduleID, &f.FiredAt, &f.FinishedAt, &f.JobID, &runID, &f.OK, &f.Error); err != nil {
+                return err
+            }
+            f.RunID = runID.Int64
+            out = append(out, f)
+        }
+        return rows.Err()
+    })
+    return out, err
+}
+
+func formatTime(t time.Time) string {
+    if t.IsZero() {
+        return ""
+    }
+    return t.UTC().Format(time.RFC3339)
+}
+
+// Scheduler fires due schedules. Fire runs the schedule's target and blocks
+// until it finishes; a schedule never overlaps with its own previous firing.
+type Scheduler struct {
+    DBPath string
+    Fire   func(ctx context.Context, s Schedule) Outcome
+
+    wake    chan struct{}
+    mu      sync.Mutex
+    running map[int64]bool
+}
+
+func NewScheduler(dbPath string, fire func(ctx context.Context, s Schedule) Outcome) *Scheduler {
+    return &Scheduler{DBPath: dbPath, Fire: fire, wake: make(chan struct{}, 1), running: map[int64]bool{}}
+}
+
+// Wake makes the scheduler re-read schedules, e.g. after they were edited.
+func (sc *Scheduler) Wake() {
+    select {
+    case sc.wake <- struct{}{}:
+    default:
+    }
+}
+
+// Start runs the scheduling loop until ctx is done.
+func (sc *Scheduler) Start(ctx context.Context) {
+    go func() {
+        for {
+            wait := sc.tick(ctx, time.Now())
+            timer := time.NewTimer(wait)
+            select {
+            case <-ctx.Done():
+                timer.Stop()
+                return
+            case <-sc.wake:
+                timer.Stop()
+            case <-timer.C:
+            }
+        }
+    }()
+}
+
+// tick fires every due schedule and returns how long to sleep until the
+// next one (at most a minute, so edits made elsewhere are picked up).
+func (sc *Scheduler) tick(ctx context.Context, now time.Time) time.Duration {
+    wait := time.Minute
+    list, err := List(sc.DBPath)
+    if err != nil {
+        log.Printf("scheduler: %v", err)
+        return wait
+    }
+    for _, s := range list {
+        if !s.Enabled {
+            continue
+        }
+        next, err := time.Parse(time.RFC3339, s.NextRunAt)
+        if err != nil {
+            continue
+        }
+        if next.After(now) {
+            if d := next.Sub(now); d < wait {
+                wait = d
+            }
+            continue
+        }
+        // missed firings (e.g. server was down) collapse into one
+        following := s.nextAfter(now)
+        if err := withDB(sc.DBPath, func(db *sql.DB) error {
+            _, err := db.Exec(`UPDATE schedules SET next_run_at = ? WHERE id = ?`, formatTime(following), s.ID)
+            return err
+        }); err != nil {
+            log.Printf("scheduler: schedule %d: %v", s.ID, err)
+            continue
+        }
+        if d := following.Sub(now); !following.IsZero() && d < wait {
+            wait = d
+        }
+        sc.fire(ctx, s, now)
+    }
+    return wait
+}
+
+func (sc *Scheduler) fire(ctx context.Context, s Schedule, firedAt time.Time) {
+    sc.mu.Lock()
+    if sc.running[s.ID] {
+        sc.mu.Unlock()
+        log.Printf("scheduler: schedule %d (%s) still running, skipping", s.ID, s.Name)
+        return
+    }
+    sc.running[s.ID] = true
+    sc.mu.Unlock()
+
+    go func() {
+        defer func() {
+            sc.mu.Lock()
+            delete(sc.running, s.ID)
+            sc.mu.Unlock()
+        }()
+        log.Printf("scheduler: firing schedule %d (%s)", s.ID, s.Name)
+        out := sc.Fire(ctx, s)
+        status := "succeeded"
+        if !out.OK {
+            status = "failed"
+        }
+        finished := time.Now().UTC().Format(time.RFC3339)
+        err := withDB(sc.DBPath, func(db *sql.DB) error {
+            var runID any
+            if out.RunID != 0 {
+                runID = out.RunID
+            }
+            if _, err := db.Exec(`INSERT INTO schedule_runs(schedule_id, fired_at, finished_at, job_id, run_id, ok, error) VALUES(?,?,?,?,?,?,?)`,
+                s.ID, formatTime(firedAt), finished, out.JobID, runID, out.OK, out.Error); err != nil {
+                return err
+            }
+            _, err := db.Exec(`UPDATE schedules SET last_run_at = ?, last_status = ? WHERE id = ?`, formatTime(firedAt), status, s.ID)
+            return err
+        })
+        if err != nil {
+            log.Printf("scheduler: schedule %d: %v", s.ID, err)
+        }
+    }()
+}